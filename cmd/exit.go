@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/kznrluk/aski/pkg/chat"
+	"github.com/kznrluk/aski/pkg/config"
+)
+
+// Exit codes, so that scripts can tell why aski failed.
+const (
+	exitError     = 1
+	exitConfig    = 2
+	exitAuth      = 3
+	exitNetwork   = 4
+	exitCancelled = 130
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, config.ErrInvalidConfig):
+		return exitConfig
+	case errors.Is(err, chat.ErrAuth):
+		return exitAuth
+	case errors.Is(err, chat.ErrNetwork):
+		return exitNetwork
+	case errors.Is(err, chat.ErrCancelled):
+		return exitCancelled
+	}
+	return exitError
+}
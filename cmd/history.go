@@ -1,13 +1,22 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+	"github.com/fatih/color"
+	"github.com/kznrluk/aski/pkg/chat"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/dataset"
+	"github.com/kznrluk/aski/pkg/export"
+	"github.com/kznrluk/aski/pkg/history"
+	"github.com/kznrluk/aski/pkg/importer"
 	"github.com/spf13/cobra"
 	"os"
-	"path/filepath"
-	"sort"
 	"strings"
+	"time"
 )
 
 var historyCmd = &cobra.Command{
@@ -16,105 +25,570 @@ var historyCmd = &cobra.Command{
 	Long: "historys are usually located in the .aski/config.yaml file in the home directory." +
 		"By using historys, you can easily switch between different conversation contexts on the fly.",
 	Args: cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
 		if len(args) == 0 {
-			list()
-		} else {
-			single(args)
+			return list(cmd)
 		}
+		return single(args)
 	},
 }
 
-func list() {
-	homeDir, err := os.UserHomeDir()
+func list(cmd *cobra.Command) error {
+	limit, _ := cmd.Flags().GetInt("limit")
+	since, _ := cmd.Flags().GetString("since")
+	profile, _ := cmd.Flags().GetString("profile")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	opts := history.ListOptions{Profile: profile, Limit: limit}
+	if since != "" {
+		t, err := history.ParseTime(since, time.Now())
+		if err != nil {
+			return err
+		}
+		opts.Since = t
+	}
+
+	summaries, err := history.List(opts)
 	if err != nil {
-		fmt.Println("Error getting home directory:", err)
-		return
+		return fmt.Errorf("error reading history directory: %w", err)
 	}
 
-	historyDir := filepath.Join(homeDir, ".aski", "history")
-	if _, err := os.Stat(historyDir); os.IsNotExist(err) {
-		return
+	if asJSON {
+		if summaries == nil {
+			summaries = []history.Summary{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summaries)
 	}
-	files, err := os.ReadDir(historyDir)
+
+	for _, s := range summaries {
+		description := s.Title
+		if description == "" {
+			description = s.Preview
+		}
+		fmt.Printf("%s %s\n", s.ID, description)
+	}
+	return nil
+}
+
+func single(args []string) error {
+	ctx, err := history.Load(args[0])
 	if err != nil {
-		fmt.Println("Error reading history directory:", err)
-		return
+		return err
 	}
-	if len(files) == 0 {
-		return
+
+	ctx.Print()
+	return nil
+}
+
+var historyExportCmd = &cobra.Command{
+	Use:   "export <id>",
+	Short: "Export a conversation to Markdown, HTML, JSON or text.",
+	Long: "Export writes the conversation from HEAD to the root message to a file. " +
+		"Use --branch to export another branch, or --all to export the whole conversation tree.",
+	Args: cobra.ExactArgs(1),
+	RunE: exportHistory,
+}
+
+func exportHistory(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	format, _ := cmd.Flags().GetString("format")
+	branch, _ := cmd.Flags().GetString("branch")
+	all, _ := cmd.Flags().GetBool("all")
+	output, _ := cmd.Flags().GetString("output")
+
+	format, err := export.ParseFormat(format)
+	if err != nil {
+		return err
 	}
 
-	sort.Slice(files, func(i, j int) bool {
-		fi, _ := files[i].Info()
-		fj, _ := files[j].Info()
-		return fi.ModTime().After(fj.ModTime())
-	})
+	ctx, err := history.Load(args[0])
+	if err != nil {
+		return err
+	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+	opts := export.Options{Format: format, Branch: branch, All: all}
+	if output == "-" {
+		err = export.Export(os.Stdout, ctx, opts)
+	} else {
+		if output == "" {
+			output = export.DefaultFilename(ctx, format)
 		}
+		err = export.ToFile(output, ctx, opts)
+	}
 
-		bytes, err := os.ReadFile(filepath.Join(historyDir, file.Name()))
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", file.Name(), err)
+	if err != nil {
+		return fmt.Errorf("error exporting %s: %w", args[0], err)
+	}
+
+	if output != "-" {
+		fmt.Println(output)
+	}
+	return nil
+}
+
+var historyImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import conversations from a ChatGPT or Claude.ai data export.",
+	Long: "Import reads conversations.json from the data export of ChatGPT or Claude.ai and saves each conversation " +
+		"to the history directory, keeping branches, timestamps and model names. " +
+		"Conversations imported before are updated instead of being duplicated.",
+	Args: cobra.ExactArgs(1),
+	RunE: importHistory,
+}
+
+func importHistory(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	format, _ := cmd.Flags().GetString("format")
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("error reading file %s: %w", args[0], err)
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	prof, err := config.GetProfile(cfg, "")
+	if err != nil {
+		return err
+	}
+
+	imported, err := importer.Import(data, format, prof)
+	if err != nil {
+		return err
+	}
+
+	sources, err := history.Sources()
+	if err != nil {
+		return fmt.Errorf("error reading history directory: %w", err)
+	}
+
+	for _, ic := range imported {
+		createdAt := ic.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+
+		filename, exists := sources[ic.Conversation.GetSource()]
+		if !exists {
+			filename = history.NewFilename(createdAt.Local())
+		}
+
+		if err := history.SaveAs(ic.Conversation, filename); err != nil {
+			fmt.Printf("Error saving %s: %v\n", filename, err)
 			continue
 		}
 
-		ctx, err := conv.FromYAML(bytes, file.Name())
+		status := "imported"
+		if exists {
+			status = "updated"
+		}
+		fmt.Printf("%s %s %s\n", strings.TrimSuffix(filename, ".yaml"), status, ic.Conversation.GetTitle())
+	}
+	return nil
+}
+
+var historyDatasetCmd = &cobra.Command{
+	Use:   "dataset [id...]",
+	Short: "Export conversations as a fine-tuning dataset.",
+	Long: "Dataset writes every path from the root to a leaf of the given conversations, or of all conversations, " +
+		"as a JSON Lines fine-tuning dataset including the system prompt. With --filter, only the paths ending at " +
+		"messages tagged with :tag are written. Examples that break role alternation or exceed the token limit are reported and skipped.",
+	RunE: datasetHistory,
+}
+
+func datasetHistory(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	out, _ := cmd.Flags().GetString("out")
+	tag, _ := cmd.Flags().GetString("filter")
+	format, _ := cmd.Flags().GetString("format")
+	maxTokens, _ := cmd.Flags().GetInt("max-tokens")
+
+	if format != dataset.FormatOpenAI && format != dataset.FormatAnthropic {
+		return fmt.Errorf("unknown dataset format: %s, must be openai or anthropic", format)
+	}
+
+	ids := args
+	if len(ids) == 0 {
+		files, err := history.Files()
 		if err != nil {
-			fmt.Printf("Error parsing file %s: %v\n", file.Name(), err)
-			continue
+			return fmt.Errorf("error reading history directory: %w", err)
 		}
+		ids = files
+	}
 
-		root, err := ctx.GetRootMessage()
+	var examples []dataset.Example
+	var problems []dataset.Problem
+	for _, id := range ids {
+		cv, err := history.Load(id)
 		if err != nil {
-			fmt.Printf("Error getting root message from file %s: %v\n", file.Name(), err)
+			fmt.Println(err)
 			continue
 		}
 
-		name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
-		content := strings.ReplaceAll(root.Content, "\n", " ")
-		if len(content) > 50 {
-			content = content[:50] + "..."
+		for _, e := range dataset.Examples(cv, tag) {
+			normalized, err := dataset.Normalize(e, maxTokens)
+			if err != nil {
+				problems = append(problems, dataset.Problem{Source: e.Source, Leaf: e.Leaf, Reason: err.Error()})
+				continue
+			}
+			examples = append(examples, normalized)
+		}
+	}
+
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", out, err)
+	}
+	defer f.Close()
+
+	if err := dataset.Write(f, examples, format); err != nil {
+		return fmt.Errorf("error writing %s: %w", out, err)
+	}
+
+	for _, p := range problems {
+		fmt.Printf("skipped %s [%.6s]: %s\n", strings.TrimSuffix(p.Source, ".yaml"), p.Leaf, p.Reason)
+	}
+	fmt.Printf("Wrote %d examples to %s, skipped %d.\n", len(examples), out, len(problems))
+	return nil
+}
+
+var historySearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search messages in the history.",
+	Long: "Search finds messages containing all keywords of the query, or matching it as a regular expression with --regex. " +
+		"Each result shows the history id and the SHA1 of the message, so it can be restored with -r and reached with :move.",
+	Args: cobra.MinimumNArgs(1),
+	RunE: searchHistory,
+}
+
+func searchHistory(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	reindex, _ := cmd.Flags().GetBool("reindex")
+	regex, _ := cmd.Flags().GetBool("regex")
+	role, _ := cmd.Flags().GetString("role")
+	profile, _ := cmd.Flags().GetString("profile")
+	model, _ := cmd.Flags().GetString("model")
+	since, _ := cmd.Flags().GetString("since")
+	until, _ := cmd.Flags().GetString("until")
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	opts := history.SearchOptions{
+		Query:   strings.Join(args, " "),
+		Regex:   regex,
+		Role:    role,
+		Profile: profile,
+		Model:   model,
+		Limit:   limit,
+	}
+
+	now := time.Now()
+	var err error
+	if since != "" {
+		if opts.Since, err = history.ParseTime(since, now); err != nil {
+			return err
+		}
+	}
+	if until != "" {
+		if opts.Until, err = history.ParseTime(until, now); err != nil {
+			return err
+		}
+	}
+
+	if reindex {
+		if err := history.Reindex(); err != nil {
+			return fmt.Errorf("error rebuilding search index: %w", err)
 		}
+	}
 
-		fmt.Printf("%s %s\n", name, content)
+	matches, err := history.Search(opts)
+	if err != nil {
+		return err
 	}
+
+	yellow := color.New(color.FgHiYellow).SprintFunc()
+	red := color.New(color.FgHiRed, color.Bold).SprintFunc()
+	for _, m := range matches {
+		snippet := m.Snippet[:m.Start] + red(m.Snippet[m.Start:m.End]) + m.Snippet[m.End:]
+		header := fmt.Sprintf("%s [%.6s] %s %s", strings.TrimSuffix(m.File, ".yaml"), m.Message.Sha1, m.Message.Role, m.Time.Local().Format("2006-01-02 15:04"))
+		fmt.Printf("%s\n  %s\n", yellow(header), snippet)
+	}
+	return nil
+}
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old conversations from the history.",
+	Long: "Prune removes conversations by the retention policy in the History section of .aski/config.yaml. " +
+		"Flags override the policy. Use --dry-run to see which conversations would be removed.",
+	Args: cobra.NoArgs,
+	RunE: pruneHistory,
 }
 
-func single(args []string) {
-	homeDir, err := os.UserHomeDir()
+func pruneHistory(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	cfg, err := config.GetConfig()
 	if err != nil {
-		fmt.Println("Error getting home directory:", err)
-		return
+		return err
 	}
 
-	historyDir := filepath.Join(homeDir, ".aski", "history")
-	if _, err := os.Stat(historyDir); os.IsNotExist(err) {
-		fmt.Println("History directory does not exist.")
-		return
+	policy := cfg.History
+	if cmd.Flags().Changed("older-than") {
+		policy.MaxAge, _ = cmd.Flags().GetString("older-than")
+	}
+	if cmd.Flags().Changed("keep-last") {
+		policy.MaxCount, _ = cmd.Flags().GetInt("keep-last")
+	}
+	if cmd.Flags().Changed("keep-tagged") {
+		policy.KeepTagged, _ = cmd.Flags().GetBool("keep-tagged")
+	}
+	if cmd.Flags().Changed("archive") {
+		policy.Archive, _ = cmd.Flags().GetBool("archive")
 	}
 
-	filePath := filepath.Join(historyDir, args[0]+".yaml")
-	bytes, err := os.ReadFile(filePath)
+	opts, err := history.PruneOptionsFromPolicy(policy)
 	if err != nil {
-		fmt.Printf("Error reading file %s: %v\n", filePath, err)
-		return
+		return err
+	}
+	if opts.OlderThan == 0 && opts.KeepLast == 0 {
+		return errors.New("no retention rule, use --older-than or --keep-last, or set History in .aski/config.yaml")
 	}
 
-	baseName := filepath.Base(filePath)
-	ctx, err := conv.FromYAML(bytes, baseName)
+	now := time.Now()
+	candidates, err := history.PruneCandidates(opts, now)
 	if err != nil {
-		fmt.Printf("Error parsing file %s: %v\n", filePath, err)
-		return
+		return fmt.Errorf("error reading history directory: %w", err)
 	}
 
-	ctx.Print()
+	if len(candidates) == 0 {
+		fmt.Println("Nothing to prune.")
+		return nil
+	}
+
+	printSummaries(candidates)
+	if dryRun {
+		fmt.Printf("%d conversations would be removed.\n", len(candidates))
+		return nil
+	}
+
+	if !yes {
+		if ok, err := confirm(fmt.Sprintf("Remove %d conversations?", len(candidates))); err != nil || !ok {
+			return err
+		}
+	}
 
+	archive, err := history.Prune(candidates, policy.Archive, now)
+	if err != nil {
+		return err
+	}
+
+	if archive != "" {
+		fmt.Printf("Archived to %s\n", archive)
+	}
+	fmt.Printf("Removed %d conversations.\n", len(candidates))
+	return nil
+}
+
+var historyArchiveCmd = &cobra.Command{
+	Use:   "archive [id...]",
+	Short: "Bundle conversations into a tar.gz file.",
+	Long: "Archive writes the conversations and an index.json with their metadata to a tar.gz file. " +
+		"Without ids every conversation is archived, or the ones not updated for --older-than.",
+	RunE: archiveHistory,
+}
+
+func archiveHistory(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	output, _ := cmd.Flags().GetString("output")
+	olderThan, _ := cmd.Flags().GetString("older-than")
+	remove, _ := cmd.Flags().GetBool("remove")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	var summaries []history.Summary
+	if len(args) > 0 {
+		for _, id := range args {
+			s, err := history.Find(id)
+			if err != nil {
+				return err
+			}
+			summaries = append(summaries, s)
+		}
+	} else {
+		opts := history.ListOptions{}
+		if olderThan != "" {
+			d, err := history.ParseDuration(olderThan)
+			if err != nil {
+				return err
+			}
+			opts.Until = time.Now().Add(-d)
+		}
+
+		var err error
+		summaries, err = history.List(opts)
+		if err != nil {
+			return fmt.Errorf("error reading history directory: %w", err)
+		}
+	}
+
+	if len(summaries) == 0 {
+		fmt.Println("Nothing to archive.")
+		return nil
+	}
+
+	if output == "" {
+		output = history.ArchiveFilename(time.Now())
+	}
+
+	if err := history.Archive(output, summaries); err != nil {
+		return fmt.Errorf("error archiving: %w", err)
+	}
+	fmt.Printf("Archived %d conversations to %s\n", len(summaries), output)
+
+	if !remove {
+		return nil
+	}
+	if !yes {
+		if ok, err := confirm(fmt.Sprintf("Remove the %d archived conversations from the history?", len(summaries))); err != nil || !ok {
+			return err
+		}
+	}
+	if err := history.Remove(summaries); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d conversations.\n", len(summaries))
+	return nil
+}
+
+var historyRmCmd = &cobra.Command{
+	Use:   "rm <id...>",
+	Short: "Remove conversations from the history.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  rmHistory,
+}
+
+func rmHistory(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	var summaries []history.Summary
+	for _, id := range args {
+		s, err := history.Find(id)
+		if err != nil {
+			return err
+		}
+		summaries = append(summaries, s)
+	}
+
+	printSummaries(summaries)
+	if !yes {
+		if ok, err := confirm(fmt.Sprintf("Remove %d conversations?", len(summaries))); err != nil || !ok {
+			return err
+		}
+	}
+
+	if err := history.Remove(summaries); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d conversations.\n", len(summaries))
+	return nil
+}
+
+var historyEncryptAllCmd = &cobra.Command{
+	Use:   "encrypt-all",
+	Short: "Encrypt the conversations saved before encryption was enabled.",
+	Long: "Encrypt-all encrypts every conversation and index in the history directory that is not encrypted yet. " +
+		"Enable encryption in the Encryption section of .aski/config.yaml first.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		count, err := history.EncryptAll()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Encrypted %d files.\n", count)
+		return nil
+	},
+}
+
+func printSummaries(summaries []history.Summary) {
+	for _, s := range summaries {
+		description := s.Title
+		if description == "" {
+			description = s.Preview
+		}
+		fmt.Printf("%s %s %s\n", s.ID, s.UpdatedAt.Local().Format("2006-01-02"), description)
+	}
+}
+
+// confirm asks the question in the terminal. It fails without a terminal, so that scripts do not exit
+// successfully having removed nothing.
+func confirm(message string) (bool, error) {
+	ok := false
+	if err := survey.AskOne(&survey.Confirm{Message: message}, &ok); err != nil {
+		if errors.Is(err, terminal.InterruptErr) {
+			return false, chat.ErrCancelled
+		}
+		return false, fmt.Errorf("cannot ask for confirmation: %v. Use --yes to remove without asking", err)
+	}
+	return ok, nil
 }
 
 func init() {
+	historyCmd.Flags().IntP("limit", "n", 0, "Maximum number of conversations to list. 0 lists all.")
+	historyCmd.Flags().String("since", "", "Only list conversations updated after this date (2024-03-01) or duration ago (30d).")
+	historyCmd.Flags().String("profile", "", "Only list conversations of this profile name.")
+	historyCmd.Flags().Bool("json", false, "Print the conversations as JSON with their metadata.")
+
+	historyExportCmd.Flags().StringP("format", "F", export.FormatMarkdown, "Output format: md, html, json or txt.")
+	historyExportCmd.Flags().StringP("branch", "b", "", "Export the branch ending at the message with this SHA1 prefix instead of HEAD.")
+	historyExportCmd.Flags().Bool("all", false, "Export every branch of the conversation tree.")
+	historyExportCmd.Flags().StringP("output", "o", "", "Output file. Defaults to <id>.<format> in the current directory. Use - for stdout.")
+
+	historyImportCmd.Flags().StringP("format", "F", "", "Export format: chatgpt or claude. Detected from the file by default.")
+
+	historyDatasetCmd.Flags().StringP("out", "o", "train.jsonl", "Output JSON Lines file.")
+	historyDatasetCmd.Flags().String("filter", "", "Only write the paths ending at messages tagged with this tag.")
+	historyDatasetCmd.Flags().StringP("format", "F", dataset.FormatOpenAI, "Dataset format: openai or anthropic.")
+	historyDatasetCmd.Flags().Int("max-tokens", dataset.DefaultMaxTokens, "Skip examples estimated to exceed this number of tokens. 0 disables the check.")
+
+	historySearchCmd.Flags().Bool("regex", false, "Treat the query as a regular expression.")
+	historySearchCmd.Flags().String("role", "", "Only search messages of this role: user or assistant.")
+	historySearchCmd.Flags().String("profile", "", "Only search conversations of this profile name.")
+	historySearchCmd.Flags().String("model", "", "Only search messages of models containing this name.")
+	historySearchCmd.Flags().String("since", "", "Only search messages after this date (2024-03-01) or duration ago (30d).")
+	historySearchCmd.Flags().String("until", "", "Only search messages before this date (2024-03-01) or duration ago (30d).")
+	historySearchCmd.Flags().IntP("limit", "n", 50, "Maximum number of results. 0 shows all.")
+	historySearchCmd.Flags().Bool("reindex", false, "Rebuild the search index before searching.")
+
+	historyPruneCmd.Flags().String("older-than", "", "Remove conversations not updated for this duration, such as 90d.")
+	historyPruneCmd.Flags().Int("keep-last", 0, "Keep only this many of the most recently updated conversations.")
+	historyPruneCmd.Flags().Bool("keep-tagged", false, "Keep conversations containing tagged messages.")
+	historyPruneCmd.Flags().Bool("archive", false, "Archive the conversations to .aski/archive before removing them.")
+	historyPruneCmd.Flags().Bool("dry-run", false, "Only list the conversations that would be removed.")
+	historyPruneCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation.")
+
+	historyArchiveCmd.Flags().StringP("output", "o", "", "Output file. Defaults to .aski/archive/aski-history-<time>.tar.gz.")
+	historyArchiveCmd.Flags().String("older-than", "", "Archive only conversations not updated for this duration, such as 90d.")
+	historyArchiveCmd.Flags().Bool("remove", false, "Remove the conversations from the history after archiving them.")
+	historyArchiveCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation.")
+
+	historyRmCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation.")
+
+	historyCmd.AddCommand(historyExportCmd)
+	historyCmd.AddCommand(historySearchCmd)
+	historyCmd.AddCommand(historyDatasetCmd)
+	historyCmd.AddCommand(historyImportCmd)
+	historyCmd.AddCommand(historyPruneCmd)
+	historyCmd.AddCommand(historyArchiveCmd)
+	historyCmd.AddCommand(historyRmCmd)
+	historyCmd.AddCommand(historyEncryptAllCmd)
 	rootCmd.AddCommand(historyCmd)
 }
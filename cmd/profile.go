@@ -1,12 +1,13 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+	"github.com/kznrluk/aski/pkg/chat"
 	"github.com/kznrluk/aski/pkg/config"
 	"github.com/spf13/cobra"
-	"log/slog"
-	"os"
-	"strings"
 )
 
 var profileCmd = &cobra.Command{
@@ -14,32 +15,24 @@ var profileCmd = &cobra.Command{
 	Short: "Select profile.",
 	Long: "Profiles are usually located in the .aski/config.yaml file in the home directory." +
 		"By using profiles, you can easily switch between different conversation contexts on the fly.",
-	Run: ChangeProfile,
+	RunE: ChangeProfile,
 }
 
 func init() {
 	rootCmd.AddCommand(profileCmd)
 }
 
-func ChangeProfile(cmd *cobra.Command, args []string) {
+func ChangeProfile(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
 	cfg, err := config.GetConfig()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	profileDir := config.MustGetProfileDir()
-
-	var yamlFiles []string
-
-	fileInfo, err := os.ReadDir(profileDir)
+	yamlFiles, err := config.ListProfiles()
 	if err != nil {
-		panic(err)
-	}
-
-	for _, file := range fileInfo {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".yaml") && file.Name() != "config.yaml" {
-			yamlFiles = append(yamlFiles, file.Name())
-		}
+		return err
 	}
 
 	var selected string
@@ -48,13 +41,17 @@ func ChangeProfile(cmd *cobra.Command, args []string) {
 		Options: yamlFiles,
 	}
 
-	_ = survey.AskOne(prompt, &selected)
+	if err := survey.AskOne(prompt, &selected); err != nil {
+		if errors.Is(err, terminal.InterruptErr) {
+			return chat.ErrCancelled
+		}
+		return err
+	}
 
 	cfg.CurrentProfile = selected
 
 	if err := config.Save(cfg); err != nil {
-		slog.Error("Error saving config", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("error saving config: %w", err)
 	}
-	return
+	return nil
 }
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/kznrluk/aski/pkg/history"
+	"strings"
+)
+
+// restorePick is the value of --restore when it is given without a value.
+const restorePick = " "
+
+// pick chooses one of the conversations matching the query. It is a variable so that tests can replace the prompt.
+var pick = pickHistory
+
+// resolveRestore returns the path of the conversation to restore. When -r is given without a value,
+// the first argument is the query and it is removed from args. An empty or ambiguous query shows a picker
+// of the matching conversations.
+func resolveRestore(restore string, args []string) (string, []string, error) {
+	query := strings.TrimSpace(restore)
+	if restore == restorePick && len(args) > 0 {
+		query, args = args[0], args[1:]
+	}
+
+	entries, err := history.Resolve(query)
+	if err != nil {
+		return "", args, err
+	}
+
+	if len(entries) == 0 {
+		return "", args, errors.New("no conversation found in history")
+	}
+
+	if len(entries) == 1 && query != "" {
+		return entries[0].Path, args, nil
+	}
+
+	entry, err := pick(entries)
+	if err != nil {
+		return "", args, err
+	}
+	return entry.Path, args, nil
+}
+
+func pickHistory(entries []history.Entry) (history.Entry, error) {
+	var options []string
+	for _, e := range entries {
+		description := e.Title
+		if description == "" {
+			description = e.Preview
+		}
+		options = append(options, fmt.Sprintf("%s  %s  %-14.14s  %s", e.ID, e.ModTime.Format("2006-01-02 15:04"), e.Model, description))
+	}
+
+	var selected int
+	prompt := &survey.Select{
+		Message:  "Choose a conversation to restore:",
+		Options:  options,
+		PageSize: 15,
+	}
+
+	if err := survey.AskOne(prompt, &selected); err != nil {
+		return history.Entry{}, err
+	}
+	return entries[selected], nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/kznrluk/aski/pkg/history"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveRestore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, id := range []string{"20240301-120000", "20240302-120000", "20250101-000000"} {
+		cv := conv.NewConversation(config.InitialProfile())
+		_, _ = cv.Append(conv.ChatRoleUser, "hello from "+id)
+		if err := history.SaveAs(cv, id+".yaml"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var offered []string
+	pick = func(entries []history.Entry) (history.Entry, error) {
+		offered = nil
+		for _, e := range entries {
+			offered = append(offered, e.ID)
+		}
+		return entries[0], nil
+	}
+	t.Cleanup(func() { pick = pickHistory })
+
+	path, args, err := resolveRestore(restorePick, []string{"2024", "continue"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(offered, []string{"20240302-120000", "20240301-120000"}) {
+		t.Errorf("Expected the picker to offer the matches only, but got %v", offered)
+	}
+	if filepath.Base(path) != "20240302-120000.yaml" || !reflect.DeepEqual(args, []string{"continue"}) {
+		t.Errorf("Expected the query to be removed from the arguments, but got %s %v", path, args)
+	}
+
+	offered = nil
+	path, args, err = resolveRestore(restorePick, []string{"2025"})
+	if err != nil || offered != nil || filepath.Base(path) != "20250101-000000.yaml" || len(args) != 0 {
+		t.Errorf("Expected a single match without the picker, but got %s %v %v %v", path, args, offered, err)
+	}
+
+	if _, args, err := resolveRestore(restorePick, []string{"qqq", "hello"}); err == nil || !reflect.DeepEqual(args, []string{"hello"}) {
+		t.Errorf("Expected an error for a query without matches, but got %v %v", args, err)
+	}
+}
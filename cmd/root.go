@@ -1,17 +1,24 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/kznrluk/aski/pkg/chat"
 	"github.com/kznrluk/aski/pkg/config"
 	"github.com/kznrluk/aski/pkg/conv"
 	"github.com/kznrluk/aski/pkg/file"
+	"github.com/kznrluk/aski/pkg/git"
+	"github.com/kznrluk/aski/pkg/history"
 	"github.com/kznrluk/aski/pkg/lib"
+	"github.com/kznrluk/aski/pkg/redact"
 	"github.com/spf13/cobra"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 var rootCmd = &cobra.Command{
@@ -19,7 +26,7 @@ var rootCmd = &cobra.Command{
 	Args:  cobra.ArbitraryArgs,
 	Short: "aski is a very small and user-friendly ChatGPT client.",
 	Long:  `aski is a very small and user-friendly ChatGPT client. It works hard to maintain context and establish communication.`,
-	Run:   aski,
+	RunE:  aski,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		if verbose {
@@ -37,27 +44,41 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
-	rootCmd.Flags().StringSliceP("file", "f", []string{}, "Input file(s) to start dialog from. Can be specified multiple times.")
+	rootCmd.Flags().StringSliceP("file", "f", []string{}, "Input file(s) to start dialog from. Can be specified multiple times. Supports ** globs, such as '**/*.go'.")
+	rootCmd.Flags().StringSliceP("exclude", "x", []string{}, "Skip files matching the pattern, in .gitignore syntax. Can be specified multiple times.")
+	rootCmd.Flags().Bool("no-ignore", false, "Attach files ignored by .gitignore and .askiignore.")
+	rootCmd.Flags().String("git-diff", "", "Attach the output of git diff for the revision, such as main...HEAD. Without a revision, the uncommitted changes.")
+	rootCmd.Flags().Lookup("git-diff").NoOptDefVal = gitDiffChanges
+	rootCmd.Flags().Bool("git-staged", false, "Attach the output of git diff --cached.")
+	rootCmd.Flags().Bool("repo-map", false, "Attach a tree of the files in the git repository with their sizes.")
+	rootCmd.Flags().String("max-file-size", "", "Budget of each attached file, such as 64KB or 8000tokens.")
+	rootCmd.Flags().String("max-total-size", "", "Budget of all attached files, such as 256KB or 32000tokens.")
+	rootCmd.Flags().String("size-strategy", "", "What to do with files over the budgets: refuse, truncate or headtail. Defaults to refuse.")
 	rootCmd.Flags().StringP("profile", "p", "", "Select the profile to use for this conversation, as defined in the .aski/config.yaml file.")
 	rootCmd.Flags().StringP("model", "m", "", "Override the model to use for this conversation. This will override the model specified in the profile.")
-	rootCmd.Flags().StringP("restore", "r", "", "Restore conversations from history yaml files. Search pwd and .aski/history folders by default. Prefix match.")
+	rootCmd.Flags().StringP("restore", "r", "", "Restore conversations from history yaml files. Search pwd and .aski/history folders by default. Prefix and fuzzy match. Without a value, choose from a list.")
+	rootCmd.Flags().Lookup("restore").NoOptDefVal = restorePick
 	rootCmd.Flags().BoolP("rest", "", false, "When you specify this flag, you will communicate with the REST API instead of streaming. This can be useful if the communication is unstable or if you are not receiving responses properly.")
 
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Debug logging")
+
+	history.PromptPassphrase = promptPassphrase
 }
 
-func aski(cmd *cobra.Command, args []string) {
+func aski(cmd *cobra.Command, args []string) error {
+	// Flags are parsed by now, so errors are not about the usage.
+	cmd.SilenceUsage = true
+
 	profileTarget, err := cmd.Flags().GetString("profile")
 	isRestMode, _ := cmd.Flags().GetBool("rest")
 	model, _ := cmd.Flags().GetString("model")
 	fileGlobs, _ := cmd.Flags().GetStringSlice("file")
 	restore, _ := cmd.Flags().GetString("restore")
-	content := strings.Join(args, " ")
 
 	isPipe := false
 	fileInfo, _ := os.Stdin.Stat()
@@ -67,44 +88,48 @@ func aski(cmd *cobra.Command, args []string) {
 
 	cfg, err := config.GetConfig()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	if cfg.OpenAIAPIKey == "" && cfg.AnthropicAPIKey == "" {
 		configPath := config.MustGetAskiDir()
-		slog.Error(fmt.Sprintf("No API key found. Please set your API key in %s/config.yaml", configPath))
-		os.Exit(1)
+		return fmt.Errorf("%w: no API key found, please set your API key in %s/config.yaml", chat.ErrAuth, configPath)
+	}
+
+	if cfg.History.AutoPrune {
+		autoPrune(cfg.History)
 	}
 
 	prof, err := config.GetProfile(cfg, profileTarget)
 	if err != nil {
-		slog.Error(fmt.Sprintf("error getting profile: %v. using default profile.", err))
-		prof = config.InitialProfile()
+		// GetProfile wraps config.ErrInvalidConfig, so that a missing or broken profile exits with its code.
+		return fmt.Errorf("error getting profile: %w", err)
 	}
 
 	if model != "" {
 		prof.Model = model
 	}
 
-	var cv conv.Conversation
-	if restore != "" {
-		histPath := config.MustGetHistoryDir()
-		if !strings.HasSuffix(restore, ".yaml") {
-			restore += ".yaml"
-		}
-		path := filepath.Join(histPath, restore)
-		fileName := filepath.Base(path)
-		load, err := os.ReadFile(path)
-
-		cv, err = conv.FromYAML(load, fileName)
+	var restorePath string
+	if cmd.Flags().Changed("restore") {
+		restorePath, args, err = resolveRestore(restore, args)
 		if err != nil {
-			slog.Error(fmt.Sprintf("error parsing restore file: %v", err))
-			os.Exit(1)
+			return fmt.Errorf("error finding restore file: %w", err)
 		}
+	}
+	if gitDiff, _ := cmd.Flags().GetString("git-diff"); gitDiff == gitDiffChanges && len(args) > 0 && git.IsRevision(args[0]) {
+		_ = cmd.Flags().Set("git-diff", args[0])
+		args = args[1:]
+	}
+	content := strings.Join(args, " ")
+	interactive := content == "" && !isPipe
 
-		if len(fileGlobs) != 0 {
-			// TODO: We should be able to renew file contents from the globs
-			slog.Warn("File globs are ignored when loading restore.")
+	var cv conv.Conversation
+	if restorePath != "" {
+		fileName := filepath.Base(restorePath)
+		cv, err = history.LoadFile(restorePath)
+		if err != nil {
+			return fmt.Errorf("error parsing restore file: %w", err)
 		}
 
 		if profileTarget != "" {
@@ -112,28 +137,33 @@ func aski(cmd *cobra.Command, args []string) {
 		}
 
 		slog.Info(fmt.Sprintf("Restoring conversation from %s", fileName))
+
+		files, err := attachFiles(cmd, cv.GetProfile(), interactive)
+		if err != nil {
+			return err
+		}
+		if err := refreshRestored(cv, files, len(fileGlobs) != 0); err != nil {
+			return err
+		}
 	} else {
 		cv = conv.NewConversation(prof)
 		cv.SetSystem(prof.SystemContext)
 
-		if len(fileGlobs) != 0 {
-			fileContents := file.GetFileContents(fileGlobs)
-			for _, f := range fileContents {
-				if content == "" && !isPipe {
-					slog.Info(fmt.Sprintf("Append File: %s", f.Name))
-				}
-				cv.Append(conv.ChatRoleUser, fmt.Sprintf("Path: `%s`\n ```\n%s```", f.Path, f.Contents))
-			}
+		files, err := attachFiles(cmd, prof, interactive)
+		if err != nil {
+			return err
+		}
+		if err := appendFiles(cv, files); err != nil {
+			return err
 		}
 
 		for _, i := range prof.Messages {
-			switch strings.ToLower(i.Role) {
-			case conv.ChatRoleUser:
-				cv.Append(conv.ChatRoleUser, i.Content)
-			case conv.ChatRoleAssistant:
-				cv.Append(conv.ChatRoleAssistant, i.Content)
-			default:
-				panic(fmt.Errorf("invalid role: %s", i.Role))
+			role := strings.ToLower(i.Role)
+			if role != conv.ChatRoleUser && role != conv.ChatRoleAssistant {
+				return fmt.Errorf("%w: invalid role in Messages of the profile: %s", config.ErrInvalidConfig, i.Role)
+			}
+			if _, err := cv.Append(role, i.Content); err != nil {
+				return err
 			}
 		}
 	}
@@ -141,20 +171,237 @@ func aski(cmd *cobra.Command, args []string) {
 	if isPipe {
 		s, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			slog.Error(fmt.Sprintf("error reading from stdin: %v", err))
-			os.Exit(1)
+			return fmt.Errorf("error reading from stdin: %w", err)
+		}
+		if err := appendInput(cv, "stdin", string(s)); err != nil {
+			return err
 		}
-		cv.Append(conv.ChatRoleUser, string(s))
 	}
 
 	if content != "" {
-		cv.Append(conv.ChatRoleUser, content)
+		if err := appendInput(cv, "input", content); err != nil {
+			return err
+		}
 		_, err = lib.OneShot(cfg, cv, isRestMode)
+		return err
+	}
+	return lib.StartDialog(cfg, cv, isRestMode)
+}
+
+// appendInput appends the prompt as a user message.
+func appendInput(cv conv.Conversation, source string, content string) error {
+	msg, err := cv.Append(conv.ChatRoleUser, content)
+	if err != nil {
+		return err
+	}
+	reportRedactions(source, msg)
+	return nil
+}
+
+func appendFiles(cv conv.Conversation, files []file.FileContents) error {
+	for _, f := range files {
+		msg, err := cv.AppendAttachment(f.Attachment(), f.Contents)
 		if err != nil {
-			slog.Error(fmt.Sprintf("error in one-shot mode: %v", err))
-			os.Exit(1)
+			return err
+		}
+		reportRedactions(f.Label(), msg)
+	}
+	return nil
+}
+
+// attachFiles reads the files given with -f and the git output requested by the flags, and fits them in the budgets
+// of the profile and the flags. The table of files is printed in interactive mode, or when a file is over a budget.
+func attachFiles(cmd *cobra.Command, prof config.Profile, interactive bool) ([]file.FileContents, error) {
+	var fileContents []file.FileContents
+
+	fileGlobs, _ := cmd.Flags().GetStringSlice("file")
+	if len(fileGlobs) != 0 {
+		excludes, _ := cmd.Flags().GetStringSlice("exclude")
+		noIgnore, _ := cmd.Flags().GetBool("no-ignore")
+
+		var skipped []file.Skipped
+		var err error
+		fileContents, skipped, err = file.GetFileContents(fileGlobs, file.Options{Exclude: excludes, NoIgnore: noIgnore})
+		if err != nil {
+			return nil, err
+		}
+		reportSkipped(skipped)
+	}
+
+	gitFiles, err := gitContents(cmd)
+	if err != nil {
+		return nil, err
+	}
+	fileContents = append(fileContents, gitFiles...)
+	if len(fileContents) == 0 {
+		return nil, nil
+	}
+
+	limits := prof.Attachments
+	if cmd.Flags().Changed("max-file-size") {
+		limits.MaxFileSize, _ = cmd.Flags().GetString("max-file-size")
+	}
+	if cmd.Flags().Changed("max-total-size") {
+		limits.MaxTotalSize, _ = cmd.Flags().GetString("max-total-size")
+	}
+	if cmd.Flags().Changed("size-strategy") {
+		limits.Strategy, _ = cmd.Flags().GetString("size-strategy")
+	}
+
+	fileContents, reports, err := file.ApplyLimits(fileContents, limits)
+	if err != nil || interactive || file.Limited(reports) {
+		file.PrintReports(os.Stderr, reports)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w. Narrow down the files, or use --size-strategy truncate or headtail", err)
+	}
+	return fileContents, nil
+}
+
+// gitDiffChanges is the value of --git-diff when it is given without a revision.
+const gitDiffChanges = " "
+
+// gitContents runs git for --git-diff, --git-staged and --repo-map. An empty diff is only reported.
+func gitContents(cmd *cobra.Command) ([]file.FileContents, error) {
+	var requests []func() (file.FileContents, error)
+	if cmd.Flags().Changed("git-diff") {
+		rev, _ := cmd.Flags().GetString("git-diff")
+		if strings.TrimSpace(rev) == "" {
+			rev = "HEAD"
+		}
+		requests = append(requests, func() (file.FileContents, error) { return git.Diff(rev) })
+	}
+	if staged, _ := cmd.Flags().GetBool("git-staged"); staged {
+		requests = append(requests, git.StagedDiff)
+	}
+	if repoMap, _ := cmd.Flags().GetBool("repo-map"); repoMap {
+		requests = append(requests, git.RepoMap)
+	}
+
+	var contents []file.FileContents
+	for _, request := range requests {
+		c, err := request()
+		if errors.Is(err, git.ErrNoChanges) {
+			slog.Warn(fmt.Sprintf("Nothing to attach, %v", err))
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error running git: %w", err)
+		}
+		contents = append(contents, c)
+	}
+	return contents, nil
+}
+
+// refreshRestored brings the attachments of a restored conversation up to date with the files given with -f.
+// Files attached before are replaced on a new branch when they changed, and new files and git output are added
+// after HEAD. Without -f, the changed files are only listed.
+func refreshRestored(cv conv.Conversation, files []file.FileContents, hasFiles bool) error {
+	changes := file.Changes(cv)
+	if !hasFiles && len(changes) > 0 {
+		slog.Warn("Attached files changed since they were attached. Use :refresh to update them.")
+		file.PrintChanges(os.Stderr, changes)
+	}
+
+	changed := map[string]file.Change{}
+	for _, c := range changes {
+		changed[c.Message.Attachment.Key()] = c
+	}
+	attached := map[string]bool{}
+	for _, m := range cv.MessagesFromHead() {
+		if m.Attachment != nil {
+			attached[m.Attachment.Key()] = true
+		}
+	}
+
+	var updates []conv.AttachmentUpdate
+	var refreshed []file.Change
+	var added []file.FileContents
+	for _, f := range files {
+		a := f.Attachment()
+		if c, ok := changed[a.Key()]; ok && c.Err == nil {
+			updates = append(updates, conv.AttachmentUpdate{Sha1: c.Message.Sha1, Attachment: a, Contents: f.Contents})
+			refreshed = append(refreshed, c)
+		} else if !attached[a.Key()] {
+			added = append(added, f)
+		}
+	}
+
+	if len(updates) > 0 {
+		head, err := cv.ReplaceAttachments(updates)
+		if err != nil {
+			return fmt.Errorf("error refreshing attached files: %w", err)
+		}
+		slog.Info(fmt.Sprintf("Replaced %d changed files on a new branch. HEAD is now [%.6s]", len(updates), head.Sha1))
+		file.PrintChanges(os.Stderr, refreshed)
+	}
+
+	return appendFiles(cv, added)
+}
+
+// maxSkippedReport limits the number of skipped files listed one by one.
+const maxSkippedReport = 10
+
+func reportSkipped(skipped []file.Skipped) {
+	for i, s := range skipped {
+		if i == maxSkippedReport {
+			slog.Info(fmt.Sprintf("Skip File: ...and %d more", len(skipped)-maxSkippedReport))
+			break
+		}
+		slog.Info(fmt.Sprintf("Skip File: %s (%s)", s.Path, s.Reason))
+	}
+}
+
+// reportRedactions warns about secrets replaced in a message, as they are not sent nor saved.
+func reportRedactions(source string, msg conv.Message) {
+	if len(msg.Redactions) > 0 {
+		slog.Warn(fmt.Sprintf("Redacted secrets from %s: %s", source, redact.Summary(msg.Redactions)))
+	}
+}
+
+// autoPrune applies the retention policy of the config. Failures are reported but do not stop aski.
+func autoPrune(policy config.HistoryPolicy) {
+	opts, err := history.PruneOptionsFromPolicy(policy)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("skipping history prune: %v", err))
+		return
+	}
+
+	now := time.Now()
+	candidates, err := history.PruneCandidates(opts, now)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("skipping history prune: %v", err))
+		return
+	}
+
+	archive, err := history.Prune(candidates, policy.Archive, now)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("failed to prune history: %v", err))
+		return
+	}
+
+	if len(candidates) > 0 {
+		slog.Info(fmt.Sprintf("pruned %d conversations from history", len(candidates)), "archive", archive)
+	}
+}
+
+func promptPassphrase(confirm bool) (string, error) {
+	var passphrase string
+	message := "Passphrase for the history:"
+	if confirm {
+		message = "New passphrase to encrypt the history:"
+	}
+	if err := survey.AskOne(&survey.Password{Message: message}, &passphrase, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr)); err != nil {
+		return "", err
+	}
+
+	if confirm {
+		var again string
+		if err := survey.AskOne(&survey.Password{Message: "Confirm the passphrase:"}, &again, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr)); err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
 		}
-	} else {
-		lib.StartDialog(cfg, cv, isRestMode)
 	}
+	return passphrase, nil
 }
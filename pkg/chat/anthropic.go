@@ -2,7 +2,6 @@ package chat
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/kznrluk/aski/pkg/conv"
 	"github.com/kznrluk/go-anthropic"
@@ -23,6 +22,17 @@ func (a ap) Retrieve(conv conv.Conversation, useRest bool) (string, error) {
 }
 
 func (a ap) RetrieveRest(conv conv.Conversation) (string, error) {
+	cancelCtx, cancelFunc := createCancellableContext()
+	defer cancelFunc()
+	data, err := a.rest(cancelCtx, conv)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("%s", data)
+	return data, nil
+}
+
+func (a ap) Complete(conv conv.Conversation) (string, error) {
 	cancelCtx, cancelFunc := createCancellableContext()
 	defer cancelFunc()
 	return a.rest(cancelCtx, conv)
@@ -35,7 +45,10 @@ func (a ap) RetrieveStream(conv conv.Conversation) (string, error) {
 }
 
 func (a ap) rest(ctx context.Context, conv conv.Conversation) (string, error) {
-	messages := conv.ToAnthropicMessage()
+	messages, err := conv.ToAnthropicMessage()
+	if err != nil {
+		return "", err
+	}
 	model := conv.GetProfile().Model
 	rest, err := a.ac.CreateMessage(
 		ctx,
@@ -48,20 +61,19 @@ func (a ap) rest(ctx context.Context, conv conv.Conversation) (string, error) {
 	)
 
 	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			return "", ErrCancelled
-		}
-		return "", err
+		return "", classify(err)
 	}
 	if len(rest.Content) == 0 {
 		return "", fmt.Errorf("no content")
 	}
-	fmt.Printf("%s", rest.Content[0].Text)
 	return rest.Content[0].Text, nil
 }
 
 func (a ap) stream(ctx context.Context, conv conv.Conversation) (string, error) {
-	messages := conv.ToAnthropicMessage()
+	messages, err := conv.ToAnthropicMessage()
+	if err != nil {
+		return "", err
+	}
 	model := conv.GetProfile().Model
 	stream, err := a.ac.CreateMessageStream(
 		ctx,
@@ -74,10 +86,7 @@ func (a ap) stream(ctx context.Context, conv conv.Conversation) (string, error)
 	)
 
 	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			return "", ErrCancelled
-		}
-		return "", err
+		return "", classify(err)
 	}
 
 	data := ""
@@ -86,12 +95,8 @@ func (a ap) stream(ctx context.Context, conv conv.Conversation) (string, error)
 		if err != nil {
 			if err == io.EOF {
 				break
-			} else if errors.Is(err, context.Canceled) {
-				return "", ErrCancelled
-			} else {
-				fmt.Printf("%s", err.Error())
-				return "", err
 			}
+			return "", classify(err)
 		}
 
 		fmt.Printf("%s", resp.Delta.Text)
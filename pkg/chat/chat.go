@@ -3,10 +3,16 @@ package chat
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/kznrluk/aski/pkg/config"
 	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/sashabaranov/go-openai"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 )
 
@@ -15,11 +21,17 @@ type (
 		Retrieve(conv conv.Conversation, useRest bool) (string, error)
 		RetrieveRest(conv conv.Conversation) (string, error)
 		RetrieveStream(conv conv.Conversation) (string, error)
+		// Complete retrieves a response over REST without printing it.
+		Complete(conv conv.Conversation) (string, error)
 	}
 )
 
 var (
 	ErrCancelled = errors.New("cancelled")
+	// ErrAuth is returned when the API key is missing or rejected.
+	ErrAuth = errors.New("authentication failed")
+	// ErrNetwork is returned when the API cannot be reached.
+	ErrNetwork = errors.New("network error")
 )
 
 func ProvideChat(vendor string, model string, cfg config.Config) (Chat, error) {
@@ -27,19 +39,55 @@ func ProvideChat(vendor string, model string, cfg config.Config) (Chat, error) {
 	switch vendor {
 	case "openai":
 		if cfg.OpenAIAPIKey == "" {
-			return nil, errors.New("OpenAI API key is not set")
+			return nil, fmt.Errorf("%w: OpenAI API key is not set, set OpenAIAPIKey in %s", ErrAuth, configPath())
 		}
 		return NewOpenAI(cfg.OpenAIAPIKey), nil
 	case "anthropic":
 		if cfg.AnthropicAPIKey == "" {
-			return nil, errors.New("Anthropic API key is not set")
+			return nil, fmt.Errorf("%w: Anthropic API key is not set, set AnthropicAPIKey in %s", ErrAuth, configPath())
 		}
 		return NewAnthropic(cfg.AnthropicAPIKey), nil
 	default:
-		return nil, errors.New("unsupported vendor: " + vendor)
+		return nil, fmt.Errorf("%w: unsupported vendor: %s", config.ErrInvalidConfig, vendor)
 	}
 }
 
+// classify wraps errors of the API clients with ErrCancelled, ErrAuth or ErrNetwork, so that callers can tell
+// what went wrong. Other errors are returned as they are.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrCancelled
+	}
+
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	}
+	// The Anthropic client returns the error body as text.
+	if status == http.StatusUnauthorized || status == http.StatusForbidden ||
+		strings.Contains(err.Error(), "authentication_error") || strings.Contains(err.Error(), "permission_error") {
+		return fmt.Errorf("%w, check the API key in %s: %v", ErrAuth, configPath(), err)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return fmt.Errorf("%w, check your connection: %v", ErrNetwork, err)
+	}
+	return err
+}
+
+func configPath() string {
+	return filepath.Join(config.MustGetAskiDir(), "config.yaml")
+}
+
 func createCancellableContext() (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(context.Background())
 
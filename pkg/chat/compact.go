@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/kznrluk/aski/pkg/token"
+	"github.com/sashabaranov/go-openai"
+	"strings"
+)
+
+const summarySystemPrompt = "You summarize conversations between a user and an AI assistant. " +
+	"Keep every fact, decision, requirement, file name and code identifier that later messages may depend on. " +
+	"Write the summary in the language of the conversation and reply with the summary only."
+
+const summaryHeader = "Summary of the earlier conversation:\n\n"
+
+// RequestTokens estimates the number of tokens the conversation uses when it is sent.
+func RequestTokens(cv conv.Conversation) int {
+	kept, _ := cv.RequestMessages()
+	return token.EstimateMessage(cv.GetSystem()) + conv.EstimateTokens(kept)
+}
+
+func NeedsCompaction(cv conv.Conversation) bool {
+	return RequestTokens(cv) > cv.GetProfile().GetRequestBudget()
+}
+
+// Compact summarizes the oldest part of the HEAD chain into a summary message so that the rest fits
+// in half of the budget. It returns the new HEAD and the number of summarized messages.
+func Compact(cli Chat, cv conv.Conversation) (conv.Message, int, error) {
+	chain := cv.MessagesFromHead()
+	if len(chain) < 3 {
+		return conv.Message{}, 0, fmt.Errorf("not enough messages to compact")
+	}
+
+	budget := cv.GetProfile().GetRequestBudget()
+	cut := findCut(chain, budget/2)
+	if cut < 1 {
+		return conv.Message{}, 0, fmt.Errorf("nothing to compact")
+	}
+
+	summary := ""
+	for _, chunk := range chunkMessages(chain[:cut], budget/2) {
+		s, err := summarize(cli, cv.GetProfile(), summary, chunk)
+		if err != nil {
+			return conv.Message{}, 0, fmt.Errorf("failed to summarize: %w", err)
+		}
+		summary = strings.TrimSpace(s)
+	}
+
+	head, err := cv.Compact(summaryHeader+summary, chain[cut].Sha1)
+	if err != nil {
+		return conv.Message{}, 0, err
+	}
+
+	return head, cut, nil
+}
+
+// findCut returns the index of the first message to keep. The kept part fits in keepTokens where possible
+// and starts with an assistant message, so that it follows the summary without breaking role alternation.
+func findCut(chain []conv.Message, keepTokens int) int {
+	cut := len(chain)
+	used := 0
+	for cut > 1 {
+		used += token.EstimateMessage(chain[cut-1].Content)
+		if used > keepTokens && cut < len(chain) {
+			break
+		}
+		cut--
+	}
+
+	for i := cut; i < len(chain); i++ {
+		if chain[i].Role == conv.ChatRoleAssistant {
+			return i
+		}
+	}
+
+	for i := cut - 1; i >= 1; i-- {
+		if chain[i].Role == conv.ChatRoleAssistant {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// chunkMessages renders the messages as transcripts that each fit in maxTokens.
+func chunkMessages(messages []conv.Message, maxTokens int) []string {
+	var chunks []string
+	current := ""
+	used := 0
+	for _, message := range messages {
+		content := message.Content
+		if token.Estimate(content) > maxTokens {
+			content = string([]rune(content)[:maxTokens]) + "\n... (truncated)"
+		}
+		entry := fmt.Sprintf("[%s]\n%s\n\n", message.Role, content)
+		size := token.Estimate(entry)
+
+		if used+size > maxTokens && current != "" {
+			chunks = append(chunks, current)
+			current = ""
+			used = 0
+		}
+		current += entry
+		used += size
+	}
+
+	if current != "" {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+func summarize(cli Chat, profile config.Profile, previous string, transcript string) (string, error) {
+	profile.DiceRoll = ""
+	profile.ResponseFormat = string(openai.ChatCompletionResponseFormatTypeText)
+	profile.CustomParameters = config.CustomParameters{}
+	profile.ContextStrategy = config.ContextStrategy{}
+
+	prompt := "Summarize the following conversation.\n\n"
+	if previous != "" {
+		prompt = "Here is a summary of the conversation so far:\n\n" + previous +
+			"\n\nUpdate the summary with the following continuation.\n\n"
+	}
+
+	sc := conv.NewConversation(profile)
+	sc.SetSystem(summarySystemPrompt)
+	if _, err := sc.Append(conv.ChatRoleUser, prompt+transcript); err != nil {
+		return "", err
+	}
+	return cli.Complete(sc)
+}
@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/kznrluk/aski/pkg/token"
+	"strings"
+	"testing"
+)
+
+// chain returns messages with the roles given as "u" or "a". Each message is 14 tokens with its overhead.
+func chain(roles ...string) []conv.Message {
+	var messages []conv.Message
+	for _, r := range roles {
+		role := conv.ChatRoleUser
+		if r == "a" {
+			role = conv.ChatRoleAssistant
+		}
+		messages = append(messages, conv.Message{Role: role, Content: strings.Repeat("x", 40)})
+	}
+	return messages
+}
+
+func TestFindCut(t *testing.T) {
+	tests := []struct {
+		name       string
+		chain      []conv.Message
+		keepTokens int
+		expected   int
+	}{
+		{name: "fits two", chain: chain("u", "a", "u", "a", "u", "a"), keepTokens: 30, expected: 5},
+		{name: "keeps the last message", chain: chain("u", "a", "u", "a", "u", "a"), keepTokens: 0, expected: 5},
+		{name: "keeps all but the first", chain: chain("u", "a", "u", "a"), keepTokens: 1000, expected: 1},
+		{name: "moves to the next reply", chain: chain("u", "a", "u", "a", "u", "a"), keepTokens: 50, expected: 3},
+		{name: "moves back to a reply", chain: chain("u", "a", "u", "a", "u", "u"), keepTokens: 0, expected: 3},
+		{name: "no reply", chain: chain("u", "u", "u"), keepTokens: 0, expected: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findCut(tt.chain, tt.keepTokens); got != tt.expected {
+				t.Errorf("Expected %d, but got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestChunkMessages(t *testing.T) {
+	messages := chain("u", "a", "u", "a", "u")
+	chunks := chunkMessages(messages, 30)
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, but got %d: %q", len(chunks), chunks)
+	}
+	for _, chunk := range chunks {
+		if token.Estimate(chunk) > 30 {
+			t.Errorf("Expected each chunk to fit in the limit, but got %d tokens", token.Estimate(chunk))
+		}
+	}
+	if !strings.HasPrefix(chunks[0], "[user]\n") || strings.Count(strings.Join(chunks, ""), "[assistant]\n") != 2 {
+		t.Errorf("Expected every message in order, but got %q", chunks)
+	}
+
+	long := []conv.Message{
+		{Role: conv.ChatRoleUser, Content: strings.Repeat("x", 500)},
+		{Role: conv.ChatRoleAssistant, Content: strings.Repeat("あ", 100)},
+	}
+	chunks = chunkMessages(long, 30)
+	if len(chunks) != 2 {
+		t.Fatalf("Expected a chunk for each long message, but got %q", chunks)
+	}
+	if want := "[user]\n" + strings.Repeat("x", 30) + "\n... (truncated)\n\n"; chunks[0] != want {
+		t.Errorf("Expected %q, but got %q", want, chunks[0])
+	}
+	if !strings.Contains(chunks[1], strings.Repeat("あ", 30)+"\n... (truncated)") || strings.Contains(chunks[1], strings.Repeat("あ", 31)) {
+		t.Errorf("Expected the reply to be truncated to the limit, but got %q", chunks[1])
+	}
+}
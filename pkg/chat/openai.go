@@ -2,7 +2,6 @@ package chat
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/kznrluk/aski/pkg/conv"
 	"github.com/sashabaranov/go-openai"
@@ -23,6 +22,17 @@ func (o oai) Retrieve(conv conv.Conversation, useRest bool) (string, error) {
 }
 
 func (o oai) RetrieveRest(conv conv.Conversation) (string, error) {
+	cancelCtx, cancelFunc := createCancellableContext()
+	defer cancelFunc()
+	data, err := o.rest(cancelCtx, conv)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("%s", data)
+	return data, nil
+}
+
+func (o oai) Complete(conv conv.Conversation) (string, error) {
 	cancelCtx, cancelFunc := createCancellableContext()
 	defer cancelFunc()
 	return o.rest(cancelCtx, conv)
@@ -62,12 +72,8 @@ func (o oai) rest(ctx context.Context, conv conv.Conversation) (string, error) {
 	)
 
 	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			return "", ErrCancelled
-		}
-		return "", err
+		return "", classify(err)
 	}
-	fmt.Printf("%s", resp.Choices[0].Message.Content)
 	return resp.Choices[0].Message.Content, nil
 }
 
@@ -99,10 +105,7 @@ func (o oai) stream(ctx context.Context, conv conv.Conversation) (string, error)
 	)
 
 	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			return "", ErrCancelled
-		}
-		return "", err
+		return "", classify(err)
 	}
 
 	data := ""
@@ -111,11 +114,8 @@ func (o oai) stream(ctx context.Context, conv conv.Conversation) (string, error)
 		if err != nil {
 			if err == io.EOF {
 				break
-			} else if errors.Is(err, context.Canceled) {
-				return "", ErrCancelled
-			} else {
-				return "", err
 			}
+			return "", classify(err)
 		}
 
 		fmt.Printf("%s", resp.Choices[0].Delta.Content)
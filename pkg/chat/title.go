@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/sashabaranov/go-openai"
+	"strings"
+)
+
+const titleSystemPrompt = "You name conversations between a user and an AI assistant. " +
+	"Reply with a short title of at most 8 words that describes the topic, in the language of the conversation. " +
+	"Do not use quotes or a trailing period."
+
+const (
+	// titleExcerptLength limits the characters of each message sent to generate a title, as the first message is often a large attachment.
+	titleExcerptLength = 1500
+	maxTitleLength     = 80
+)
+
+// GenerateTitle asks the model for a short title of the conversation based on its first exchange.
+// The TitleModel of the profile is used when it is set.
+func GenerateTitle(cli Chat, cv conv.Conversation) (string, error) {
+	chain := cv.MessagesFromHead()
+
+	transcript := ""
+	for i, m := range chain {
+		content := m.Content
+		if len([]rune(content)) > titleExcerptLength {
+			content = string([]rune(content)[:titleExcerptLength]) + "\n... (truncated)"
+		}
+		if m.Attachment != nil {
+			content = fmt.Sprintf("(attached file %s)\n%s", m.Attachment.Label(), content)
+		}
+		transcript += fmt.Sprintf("[%s]\n%s\n\n", m.Role, content)
+
+		if m.Role == conv.ChatRoleAssistant || i >= 5 {
+			break
+		}
+	}
+
+	if transcript == "" {
+		return "", fmt.Errorf("no messages to name")
+	}
+
+	profile := cv.GetProfile()
+	if profile.TitleModel != "" {
+		profile.Model = profile.TitleModel
+	}
+	profile.DiceRoll = ""
+	profile.ResponseFormat = string(openai.ChatCompletionResponseFormatTypeText)
+	profile.CustomParameters = config.CustomParameters{}
+	profile.ContextStrategy = config.ContextStrategy{}
+
+	tc := conv.NewConversation(profile)
+	tc.SetSystem(titleSystemPrompt)
+	if _, err := tc.Append(conv.ChatRoleUser, "Write a title for the following conversation.\n\n"+transcript); err != nil {
+		return "", err
+	}
+
+	title, err := cli.Complete(tc)
+	if err != nil {
+		return "", err
+	}
+	return cleanTitle(title), nil
+}
+
+func cleanTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(strings.TrimSpace(title), "\"'`*#「」 ")
+	title = strings.TrimSuffix(title, ".")
+
+	if len([]rune(title)) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength])
+	}
+	return title
+}
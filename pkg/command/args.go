@@ -0,0 +1,192 @@
+package command
+
+import (
+	"fmt"
+	"github.com/kballard/go-shellquote"
+	"strings"
+)
+
+// argKind - What an argument of a command takes. The kind decides how the argument is shown in the usage
+// and how it is completed.
+type argKind int
+
+const (
+	// argWord is any single word.
+	argWord argKind = iota
+	// argSha1 is a partial SHA1 of a message.
+	argSha1
+	// argPath is a file path or a glob.
+	argPath
+	// argParam is the name of a custom parameter of the profile.
+	argParam
+	// argTag is the name of a message tag.
+	argTag
+	// argProfile is the name of a profile in the profile directory.
+	argProfile
+	// argFlag is a flag such as --all. Flags may be given anywhere after the command.
+	argFlag
+	// argText is the rest of the line as typed, quotes included. It must be the only argument.
+	argText
+)
+
+// arg - An argument of a command. Choices are the values shown in the usage and offered for completion.
+// The command checks the value itself, as it may accept others, such as markdown for md. Choices of a flag
+// are other names of the flag.
+type arg struct {
+	name     string
+	kind     argKind
+	choices  []string
+	optional bool
+	variadic bool
+}
+
+func (a arg) String() string {
+	s := a.name
+	if len(a.choices) > 0 && a.kind == argWord {
+		s = strings.Join(a.choices, "|")
+	} else if len(a.choices) > 0 {
+		s += "|" + strings.Join(a.choices, "|")
+	}
+	if a.variadic {
+		s += " ..."
+	}
+	if a.optional || a.kind == argFlag {
+		s = "[" + s + "]"
+	}
+	return s
+}
+
+// usage returns the command with its arguments, such as `:export [md|html|json|txt] [path] [--all]`.
+func (c cmd) usage() string {
+	parts := []string{c.name}
+	for _, a := range c.args {
+		parts = append(parts, a.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// help returns the usage, the aliases and the description of the command.
+func (c cmd) help() string {
+	s := fmt.Sprintf("Usage: %s\n", c.usage())
+	if len(c.aliases) > 0 {
+		s += fmt.Sprintf("Aliases: %s\n", strings.Join(c.aliases, ", "))
+	}
+	return s + "\n" + strings.ReplaceAll(c.description, "\n                   ", "\n") + "\n"
+}
+
+// positional returns the arguments that are not flags.
+func (c cmd) positional() []arg {
+	var args []arg
+	for _, a := range c.args {
+		if a.kind != argFlag {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// argAt returns the positional argument at the index, following a variadic last argument.
+func (c cmd) argAt(i int) (arg, bool) {
+	args := c.positional()
+	if i < len(args) {
+		return args[i], true
+	}
+	if len(args) > 0 && args[len(args)-1].variadic {
+		return args[len(args)-1], true
+	}
+	return arg{}, false
+}
+
+// splitArgs splits the arguments after the command like a shell does, so that quotes and backslashes
+// keep spaces in a single argument. Commands taking paths keep other backslashes, as in C:\src\main.go.
+func (c cmd) splitArgs(rest string) ([]string, error) {
+	if len(c.args) == 1 && c.args[0].kind == argText {
+		if rest = strings.TrimSpace(rest); rest == "" {
+			return nil, nil
+		}
+		return []string{rest}, nil
+	}
+
+	for _, a := range c.args {
+		if a.kind == argPath {
+			rest = keepBackslashes(rest)
+			break
+		}
+	}
+
+	words, err := shellquote.Split(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%s", strings.ToLower(err.Error()))
+	}
+	return words, nil
+}
+
+// keepBackslashes escapes the backslashes outside quotes that do not escape a space, a quote or another
+// backslash, so that splitting keeps them.
+func keepBackslashes(s string) string {
+	var b strings.Builder
+	var open rune
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case open != 0:
+			if r == '\\' && open == '"' && i+1 < len(runes) {
+				b.WriteRune(r)
+				i++
+				r = runes[i]
+			} else if r == open {
+				open = 0
+			}
+		case r == '"' || r == '\'':
+			open = r
+		case r == '\\':
+			if i+1 < len(runes) && strings.ContainsRune(" \t\n\"'\\", runes[i+1]) {
+				// An escape, copied with the escaped character.
+				b.WriteRune(r)
+				i++
+				r = runes[i]
+			} else {
+				b.WriteRune('\\')
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// checkArgs reports missing, unknown and extra arguments.
+func (c cmd) checkArgs(words []string) error {
+	flags := map[string]bool{}
+	for _, a := range c.args {
+		if a.kind == argFlag {
+			flags[a.name] = true
+			for _, choice := range a.choices {
+				flags[choice] = true
+			}
+		}
+	}
+
+	var positional []string
+	for _, w := range words {
+		if strings.HasPrefix(w, "--") && len(flags) > 0 {
+			if !flags[w] {
+				return fmt.Errorf("unknown flag: %s", w)
+			}
+			continue
+		}
+		positional = append(positional, w)
+	}
+
+	for i, a := range c.positional() {
+		if i >= len(positional) && !a.optional {
+			return fmt.Errorf("missing %s", a.name)
+		}
+	}
+	if len(positional) > 0 {
+		if _, ok := c.argAt(len(positional) - 1); !ok {
+			return fmt.Errorf("too many arguments")
+		}
+	}
+	return nil
+}
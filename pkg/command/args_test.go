@@ -0,0 +1,98 @@
+package command
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"reflect"
+	"testing"
+)
+
+func command(t *testing.T, name string) cmd {
+	c, ok := matchCommand(name)
+	if !ok {
+		t.Fatalf("command not found: %s", name)
+	}
+	return *c
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		rest string
+		want []string
+	}{
+		{":param", `stop "a, b"`, []string{"stop", "a, b"}},
+		{":pin", "  abc123  ", []string{"abc123"}},
+		{":attach", `my\ file.go 'other file.go'`, []string{"my file.go", "other file.go"}},
+		{":attach", `C:\src\main.go "C:\\Program Files\\a.go" 'C:\b\c.go'`, []string{`C:\src\main.go`, `C:\Program Files\a.go`, `C:\b\c.go`}},
+		{":attach", `dir\\file.go a\"b.go`, []string{`dir\file.go`, `a"b.go`}},
+		{":param", `stop a\b`, []string{"stop", "ab"}},
+		{":title", ` it's "quoted" `, []string{`it's "quoted"`}},
+		{":title", "  ", nil},
+	}
+	for _, tt := range tests {
+		got, err := command(t, tt.name).splitArgs(tt.rest)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: got %q, %v, want %q", tt.name, tt.rest, got, err, tt.want)
+		}
+	}
+
+	if _, err := command(t, ":param").splitArgs(`stop "a`); err == nil {
+		t.Errorf("Expected an error for an unterminated quote")
+	}
+}
+
+func TestCheckArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{":pin", nil, true},
+		{":pin", []string{"abc"}, false},
+		{":pin", []string{"abc", "def"}, true},
+		{":attach", []string{"a.go", "b.go", "c.go"}, false},
+		{":export", []string{"json", "out.json", "--all"}, false},
+		{":export", []string{"--all", "json"}, false},
+		{":export", []string{"--bogus"}, true},
+		{":gitdiff", []string{"--staged"}, false},
+		{":gitdiff", []string{"main", "--cached"}, false},
+		{":history", []string{"extra"}, true},
+	}
+	for _, tt := range tests {
+		if err := command(t, tt.name).checkArgs(tt.args); (err != nil) != tt.wantErr {
+			t.Errorf("%s %q: got %v, wantErr %v", tt.name, tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := map[string]string{
+		":export":  ":export [md|html|json|txt] [path] [--all]",
+		":editor":  ":editor [sha1|latest]",
+		":attach":  ":attach path ...",
+		":tag":     ":tag name [sha1]",
+		":config":  ":config",
+		":gitdiff": ":gitdiff [rev] [--staged|--cached]",
+	}
+	for name, want := range tests {
+		if got := command(t, name).usage(); got != want {
+			t.Errorf("usage of %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParseQuotedArgument(t *testing.T) {
+	cv := conv.NewConversation(config.InitialProfile())
+
+	if _, _, err := Parse(`:param stop "a, b"`, cv, config.Config{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cv.GetProfile().CustomParameters.Stop; !reflect.DeepEqual(got, []string{"a", " b"}) {
+		t.Errorf("Expected the quoted value as one argument, but got %q", got)
+	}
+
+	if _, _, err := Parse(":pin", cv, config.Config{}); err == nil {
+		t.Errorf("Expected an error for a missing argument")
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/fatih/color"
+	"github.com/kznrluk/aski/pkg/chat"
 	"github.com/kznrluk/aski/pkg/config"
 	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/kznrluk/aski/pkg/export"
+	"github.com/kznrluk/aski/pkg/file"
+	"github.com/kznrluk/aski/pkg/git"
+	"github.com/kznrluk/aski/pkg/redact"
 	"os"
 	"os/exec"
 	"runtime"
@@ -17,77 +22,105 @@ var (
 	ErrShouldExit = errors.New("should exit")
 )
 
-type cmdFn func(commands []string, conv conv.Conversation) (conv.Conversation, bool, error)
+type cmdFn func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error)
 
 type cmd struct {
 	name        string
 	aliases     []string
+	args        []arg
 	description string
 	exec        cmdFn
+	// custom is set on commands defined in the config, see Register.
+	custom bool
 }
 
 var availableCommands = []cmd{
 	{
 		name:        ":history",
 		description: "Show conversation history.",
-		exec: func(commands []string, conv conv.Conversation) (conv.Conversation, bool, error) {
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
 			conv.Print()
 			return nil, false, nil
 		},
 	},
 	{
 		name:        ":move",
+		args:        []arg{{name: "sha1", kind: argSha1}},
 		description: "Change HEAD to another message.",
-		exec: func(commands []string, conv conv.Conversation) (conv.Conversation, bool, error) {
-			if len(commands) < 2 {
-				return nil, false, fmt.Errorf("no SHA1 partial provided")
-			}
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
 			err := changeHead(commands[1], conv)
 			return nil, false, err
 		},
 	},
 	{
-		name:        ":config",
+		name: ":config",
+		// The short forms ran :config before :compact was added.
+		aliases:     []string{":c", ":co"},
 		description: "Open configuration directory.",
-		exec: func(commands []string, conv conv.Conversation) (conv.Conversation, bool, error) {
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
 			_ = config.OpenConfigDir()
 			return nil, false, nil
 		},
 	},
+	{
+		name: ":profile",
+		args: []arg{{name: "name", kind: argProfile, optional: true}},
+		description: "Show or switch the profile of the conversation.\n" +
+			"                   The messages and the system prompt of the conversation are kept.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return switchProfile(conv, cfg, commands[1:])
+		},
+	},
+	{
+		name: ":model",
+		args: []arg{{name: "name", optional: true}, {name: "vendor", choices: []string{"openai", "anthropic"}, optional: true}},
+		description: "Show or switch the model of the current profile.\n" +
+			"                   Give the vendor when the model is not from the vendor of the profile.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return switchModel(conv, cfg, commands[1:])
+		},
+	},
 	{
 		name: ":editor",
+		args: []arg{{name: "sha1", kind: argSha1, choices: []string{"latest"}, optional: true}},
 		description: "Open an external text editor to add new message.\n" +
 			"  :editor sha1   - Edit the argument message and continue the conversation.\n" +
 			"  :editor latest - Edits the nearest own statement from HEAD.",
-		exec: func(commands []string, conv conv.Conversation) (conv.Conversation, bool, error) {
-			trim := ""
-			if len(commands) > 1 {
-				trim = strings.TrimSpace(commands[1])
-			}
-
-			if trim == "" {
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			if len(commands) < 2 {
 				return newMessage(conv)
 			}
 
-			return editMessage(conv, trim)
+			return editMessage(conv, commands[1])
+		},
+	},
+	{
+		name: ":system",
+		description: "Edit the system prompt in an external editor.\n" +
+			"                   The new prompt is used from the next message, other branches keep theirs.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return editSystem(conv)
 		},
 	},
 	{
-		name: ":modify sha1",
+		name: ":modify",
+		// :mod ran :modify before :model was added.
+		aliases: []string{":mod"},
+		args:    []arg{{name: "sha1", kind: argSha1}},
 		description: "Modify the past conversation. HEAD does not move.\n" +
 			"                   Past conversations will be modified from the next transmission.",
-		exec: func(commands []string, conv conv.Conversation) (conv.Conversation, bool, error) {
-			if len(commands) < 2 {
-				return nil, false, fmt.Errorf("no SHA1 provided")
-			}
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
 			return modifyMessage(conv, commands[1])
 		},
 	},
 	{
 		name: ":param",
+		// :p ran :param before :pin and :profile were added.
+		aliases: []string{":p"},
+		args:    []arg{{name: "name", kind: argParam, optional: true}, {name: "value", optional: true}},
 		description: "Update profile custom parameter values.\n" +
 			"                   There is no need to change it for normal use.",
-		exec: func(commands []string, conv conv.Conversation) (conv.Conversation, bool, error) {
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
 			if len(commands) < 3 {
 				if len(commands) == 2 {
 					displayParameterValue(conv.GetProfile().CustomParameters, commands[1])
@@ -104,11 +137,108 @@ var availableCommands = []cmd{
 			return cv, false, err
 		},
 	},
+	{
+		name:        ":pin",
+		args:        []arg{{name: "sha1", kind: argSha1}},
+		description: "Pin a message so that it is always sent, even from other branches.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return setPinned(conv, commands[1], true)
+		},
+	},
+	{
+		name:        ":unpin",
+		args:        []arg{{name: "sha1", kind: argSha1}},
+		description: "Unpin a message.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return setPinned(conv, commands[1], false)
+		},
+	},
+	{
+		name:        ":tag",
+		args:        []arg{{name: "name", kind: argTag}, {name: "sha1", kind: argSha1, optional: true}},
+		description: "Tag HEAD, or the message given as the second argument.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return setTag(conv, commands[1:], true)
+		},
+	},
+	{
+		name:        ":untag",
+		args:        []arg{{name: "name", kind: argTag}, {name: "sha1", kind: argSha1, optional: true}},
+		description: "Remove a tag from HEAD, or the message given as the second argument.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return setTag(conv, commands[1:], false)
+		},
+	},
+	{
+		name: ":export",
+		args: []arg{
+			{name: "format", choices: []string{"md", "html", "json", "txt"}, optional: true},
+			{name: "path", kind: argPath, optional: true},
+			{name: "--all", kind: argFlag},
+		},
+		description: "Export the conversation to a file.\n" +
+			"                   Exports from HEAD to the root message, or every branch with --all.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return exportConversation(conv, commands[1:])
+		},
+	},
+	{
+		name: ":title",
+		args: []arg{{name: "text", kind: argText, choices: []string{"auto"}, optional: true}},
+		description: "Show or set the title of the conversation.\n" +
+			"                   auto asks the model for a title.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return setTitle(conv, cfg, strings.Join(commands[1:], " "))
+		},
+	},
+	{
+		name: ":attach",
+		args: []arg{{name: "path", kind: argPath, variadic: true}},
+		description: "Attach files after HEAD.\n" +
+			"                   Attach a part of a file with path:10-80 or path#Name.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return attachFiles(conv, commands[1:])
+		},
+	},
+	{
+		name: ":detach",
+		args: []arg{{name: "sha1", kind: argSha1}},
+		description: "Remove an attachment from the current branch.\n" +
+			"                   The branch is copied without it, the original stays in the history.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return detachFile(conv, commands[1])
+		},
+	},
+	{
+		name: ":gitdiff",
+		args: []arg{{name: "rev", optional: true}, {name: "--staged", kind: argFlag, choices: []string{"--cached"}}},
+		description: "Attach the output of git diff after HEAD.\n" +
+			"                   Without a revision, the uncommitted changes.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return attachGitDiff(conv, commands[1:])
+		},
+	},
+	{
+		name: ":refresh",
+		args: []arg{{name: "mode", choices: []string{"replace", "append"}, optional: true}},
+		description: "Update the attached files changed on disk.\n" +
+			"                   Replaces them in a copy of the current branch, or adds them after HEAD with append.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return refreshAttachments(conv, commands[1:])
+		},
+	},
+	{
+		name:        ":compact",
+		description: "Summarize older messages of the current branch to fit in the context window.",
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return compactConversation(conv, cfg)
+		},
+	},
 	{
 		name:        ":exit",
 		aliases:     []string{":q", ":quit"},
 		description: "Exit the program.",
-		exec: func(commands []string, conv conv.Conversation) (conv.Conversation, bool, error) {
+		exec: func(commands []string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
 			return nil, false, ErrShouldExit
 		},
 	},
@@ -150,19 +280,38 @@ func unknownCommand() string {
 		output += fmt.Sprintf("  %-14s - %s\n", cmd.name, cmd.description)
 	}
 
-	return output
+	return output + "\nAdd --help to a command to show its usage.\n"
 }
 
-func Parse(input string, conv conv.Conversation) (conv.Conversation, bool, error) {
+// Parse runs the inline command in the input. Arguments are split like a shell does, so quotes keep spaces
+// in a single argument, and are checked against the arguments of the command before it runs.
+func Parse(input string, conv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
 	trimmedInput := strings.TrimSpace(input)
-	commands := strings.Split(trimmedInput, " ")
+	name, rest := trimmedInput, ""
+	if i := strings.IndexAny(trimmedInput, " \t"); i >= 0 {
+		name, rest = trimmedInput[:i], trimmedInput[i+1:]
+	}
 
-	matchedCmd, found := matchCommand(commands[0])
+	matchedCmd, found := matchCommand(name)
 	if !found {
 		return nil, false, fmt.Errorf(unknownCommand())
 	}
 
-	return matchedCmd.exec(commands, conv)
+	args, err := matchedCmd.splitArgs(rest)
+	if err != nil {
+		return nil, false, fmt.Errorf("%v\nUsage: %s", err, matchedCmd.usage())
+	}
+	for _, a := range args {
+		if a == "--help" {
+			fmt.Print(matchedCmd.help())
+			return nil, false, nil
+		}
+	}
+	if err := matchedCmd.checkArgs(args); err != nil {
+		return nil, false, fmt.Errorf("%v\nUsage: %s", err, matchedCmd.usage())
+	}
+
+	return matchedCmd.exec(append([]string{name}, args...), conv, cfg)
 }
 
 func changeHead(sha1Partial string, context conv.Conversation) error {
@@ -184,6 +333,342 @@ func changeHead(sha1Partial string, context conv.Conversation) error {
 	return nil
 }
 
+func setPinned(cv conv.Conversation, sha1 string, pinned bool) (conv.Conversation, bool, error) {
+	msg, err := cv.GetMessageFromSha1(strings.TrimSpace(sha1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	msg.Pinned = pinned
+	if err := cv.Modify(msg); err != nil {
+		return nil, false, fmt.Errorf("failed to modify message: %v", err)
+	}
+
+	if pinned {
+		fmt.Printf("[%.6s] Pinned. \n", msg.Sha1)
+	} else {
+		fmt.Printf("[%.6s] Unpinned. \n", msg.Sha1)
+	}
+	return cv, false, nil
+}
+
+func setTag(cv conv.Conversation, args []string, add bool) (conv.Conversation, bool, error) {
+	if len(args) < 1 || strings.TrimSpace(args[0]) == "" {
+		return nil, false, fmt.Errorf("no tag provided")
+	}
+	tag := strings.TrimSpace(args[0])
+
+	var msg conv.Message
+	if len(args) > 1 {
+		m, err := cv.GetMessageFromSha1(strings.TrimSpace(args[1]))
+		if err != nil {
+			return nil, false, err
+		}
+		msg = m
+	} else {
+		chain := cv.MessagesFromHead()
+		if len(chain) == 0 {
+			return nil, false, fmt.Errorf("no message to tag")
+		}
+		msg = chain[len(chain)-1]
+	}
+
+	tags := []string{}
+	for _, t := range msg.Tags {
+		if t != tag {
+			tags = append(tags, t)
+		}
+	}
+	if add {
+		tags = append(tags, tag)
+	}
+	msg.Tags = tags
+
+	if err := cv.Modify(msg); err != nil {
+		return nil, false, fmt.Errorf("failed to modify message: %v", err)
+	}
+
+	fmt.Printf("[%.6s] Tags: %s \n", msg.Sha1, strings.Join(msg.Tags, ", "))
+	return cv, false, nil
+}
+
+func exportConversation(cv conv.Conversation, args []string) (conv.Conversation, bool, error) {
+	opts := export.Options{Format: export.FormatMarkdown}
+	var positional []string
+	for _, arg := range args {
+		if arg == "--all" {
+			opts.All = true
+		} else if arg != "" {
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) > 0 {
+		format, err := export.ParseFormat(positional[0])
+		if err != nil {
+			return nil, false, err
+		}
+		opts.Format = format
+	}
+
+	path := export.DefaultFilename(cv, opts.Format)
+	if len(positional) > 1 {
+		path = positional[1]
+	}
+
+	if err := export.ToFile(path, cv, opts); err != nil {
+		return nil, false, fmt.Errorf("failed to export: %v", err)
+	}
+
+	fmt.Printf("Exported to %s\n", path)
+	return cv, false, nil
+}
+
+func setTitle(cv conv.Conversation, cfg config.Config, title string) (conv.Conversation, bool, error) {
+	if title == "" {
+		if cv.GetTitle() == "" {
+			fmt.Println("No title. Use :title text or :title auto to set one.")
+		} else {
+			fmt.Printf("Title: %s\n", cv.GetTitle())
+		}
+		return cv, false, nil
+	}
+
+	if title == "auto" {
+		profile := cv.GetProfile()
+		cli, err := chat.ProvideChat(profile.Vendor, profile.Model, cfg)
+		if err != nil {
+			return nil, false, fmt.Errorf("error providing chat client: %v", err)
+		}
+
+		generated, err := chat.GenerateTitle(cli, cv)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to generate title: %v", err)
+		}
+		title = generated
+	}
+
+	cv.SetTitle(title)
+	fmt.Printf("Title: %s\n", title)
+	return cv, false, nil
+}
+
+func attachFiles(cv conv.Conversation, args []string) (conv.Conversation, bool, error) {
+	var globs []string
+	for _, arg := range args {
+		if arg != "" {
+			globs = append(globs, arg)
+		}
+	}
+	if len(globs) == 0 {
+		return nil, false, fmt.Errorf("no file provided")
+	}
+
+	files, skipped, err := file.GetFileContents(globs, file.Options{})
+	if err != nil {
+		return nil, false, err
+	}
+	for _, s := range skipped {
+		fmt.Printf("Skip File: %s (%s)\n", s.Path, s.Reason)
+	}
+	return appendAttachments(cv, files)
+}
+
+func detachFile(cv conv.Conversation, sha1 string) (conv.Conversation, bool, error) {
+	msg, err := cv.GetMessageFromSha1(sha1)
+	if err != nil {
+		return nil, false, err
+	}
+	if msg.Attachment == nil {
+		return nil, false, fmt.Errorf("[%.6s] is not an attachment", msg.Sha1)
+	}
+
+	head, err := cv.Detach(msg.Sha1)
+	if err != nil {
+		return nil, false, err
+	}
+	fmt.Printf("Detached %s [%.6s]. HEAD is now [%.6s]\n", msg.Attachment.Label(), msg.Sha1, head.Sha1)
+	return cv, false, nil
+}
+
+func attachGitDiff(cv conv.Conversation, args []string) (conv.Conversation, bool, error) {
+	rev := "HEAD"
+	staged := false
+	for _, arg := range args {
+		if arg == "--staged" || arg == "--cached" {
+			staged = true
+		} else {
+			rev = arg
+		}
+	}
+
+	var diff file.FileContents
+	var err error
+	if staged {
+		diff, err = git.StagedDiff()
+	} else {
+		diff, err = git.Diff(rev)
+	}
+	if errors.Is(err, git.ErrNoChanges) {
+		fmt.Printf("Nothing to attach, %v\n", err)
+		return cv, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return appendAttachments(cv, []file.FileContents{diff})
+}
+
+// appendAttachments fits the contents in the budgets of the profile and appends them after HEAD.
+func appendAttachments(cv conv.Conversation, files []file.FileContents) (conv.Conversation, bool, error) {
+	files, reports, err := file.ApplyLimits(files, cv.GetProfile().Attachments)
+	if len(reports) > 0 {
+		file.PrintReports(os.Stdout, reports)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(files) == 0 {
+		return cv, false, nil
+	}
+
+	var head conv.Message
+	for _, f := range files {
+		head, err = cv.AppendAttachment(f.Attachment(), f.Contents)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(head.Redactions) > 0 {
+			fmt.Printf("Redacted secrets from %s: %s\n", f.Label(), redact.Summary(head.Redactions))
+		}
+	}
+	fmt.Printf("Attached %d files. HEAD is now [%.6s]\n", len(files), head.Sha1)
+	return cv, false, nil
+}
+
+func refreshAttachments(cv conv.Conversation, args []string) (conv.Conversation, bool, error) {
+	appendMode := false
+	if len(args) > 0 && args[0] != "" {
+		switch args[0] {
+		case "append":
+			appendMode = true
+		case "replace":
+		default:
+			return nil, false, fmt.Errorf("unknown mode: %s, must be replace or append", args[0])
+		}
+	}
+
+	changes := file.Changes(cv)
+	if len(changes) == 0 {
+		fmt.Println("No attached file has changed.")
+		return cv, false, nil
+	}
+	file.PrintChanges(os.Stdout, changes)
+
+	updates, reports, err := file.Updates(changes, cv.GetProfile().Attachments)
+	if err != nil || file.Limited(reports) {
+		file.PrintReports(os.Stdout, reports)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(updates) == 0 {
+		return cv, false, nil
+	}
+
+	if appendMode {
+		var head conv.Message
+		for _, u := range updates {
+			head, err = cv.AppendAttachment(u.Attachment, u.Contents)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		fmt.Printf("Added %d files after the previous HEAD. HEAD is now [%.6s]\n", len(updates), head.Sha1)
+		return cv, false, nil
+	}
+
+	head, err := cv.ReplaceAttachments(updates)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to refresh: %v", err)
+	}
+	fmt.Printf("Replaced %d files on a new branch. HEAD is now [%.6s]\n", len(updates), head.Sha1)
+	return cv, false, nil
+}
+
+func compactConversation(cv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+	profile := cv.GetProfile()
+	cli, err := chat.ProvideChat(profile.Vendor, profile.Model, cfg)
+	if err != nil {
+		return nil, false, fmt.Errorf("error providing chat client: %v", err)
+	}
+
+	before := chat.RequestTokens(cv)
+	head, summarized, err := chat.Compact(cli, cv)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to compact: %v", err)
+	}
+
+	yellow := color.New(color.FgHiYellow).SprintFunc()
+	fmt.Printf("%s\n", yellow(fmt.Sprintf("Compacted %d messages. ~%d -> ~%d tokens (budget %d)", summarized, before, chat.RequestTokens(cv), profile.GetRequestBudget())))
+	fmt.Printf("%s\n", yellow(fmt.Sprintf("Original messages are kept on a side branch. HEAD is now [%.6s]", head.Sha1)))
+	return cv, false, nil
+}
+
+// switchProfile loads the profile and makes it the profile of the conversation. The following replies are
+// retrieved with its model. The dialog registers the commands of the profile, see Register.
+func switchProfile(cv conv.Conversation, cfg config.Config, args []string) (conv.Conversation, bool, error) {
+	if len(args) == 0 {
+		printProfile(cv.GetProfile())
+		return cv, false, nil
+	}
+
+	profile, err := config.GetProfile(cfg, args[0])
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := chat.ProvideChat(profile.Vendor, profile.Model, cfg); err != nil {
+		return nil, false, err
+	}
+	if err := cv.SetProfile(profile); err != nil {
+		return nil, false, err
+	}
+
+	printProfile(profile)
+	if profile.SystemContext != cv.GetSystem() {
+		fmt.Println("The system prompt of the conversation is kept, use :system to change it.")
+	}
+	return cv, false, nil
+}
+
+func switchModel(cv conv.Conversation, cfg config.Config, args []string) (conv.Conversation, bool, error) {
+	profile := cv.GetProfile()
+	if len(args) == 0 {
+		printProfile(profile)
+		return cv, false, nil
+	}
+
+	profile.Model = args[0]
+	if len(args) > 1 {
+		profile.Vendor = args[1]
+	}
+	if err := config.ValidateProfile(profile); err != nil {
+		return nil, false, err
+	}
+	if _, err := chat.ProvideChat(profile.Vendor, profile.Model, cfg); err != nil {
+		return nil, false, err
+	}
+	if err := cv.SetProfile(profile); err != nil {
+		return nil, false, err
+	}
+
+	printProfile(profile)
+	return cv, false, nil
+}
+
+func printProfile(profile config.Profile) {
+	fmt.Printf("Profile: %s, Model: %s, Vendor: %s\n", profile.ProfileName, profile.Model, profile.Vendor)
+}
+
 func newMessage(cv conv.Conversation) (conv.Conversation, bool, error) {
 	comments := "\n\n# Save and close editor to continue\n"
 	s := cv.MessagesFromHead()
@@ -210,7 +695,9 @@ func newMessage(cv conv.Conversation) (conv.Conversation, bool, error) {
 		return cv, false, nil
 	}
 
-	cv.Append(conv.ChatRoleUser, result)
+	if _, err := cv.Append(conv.ChatRoleUser, result); err != nil {
+		return nil, false, err
+	}
 	return cv, true, nil
 }
 
@@ -262,6 +749,9 @@ func modifyMessage(cv conv.Conversation, sha1 string) (conv.Conversation, bool,
 	}
 
 	fmt.Printf("[%.6s] Modified. \n", msg.Sha1)
+	if modified, err := cv.GetMessageFromSha1(msg.Sha1); err == nil && redact.Summary(modified.Redactions) != redact.Summary(msg.Redactions) {
+		fmt.Printf("Redacted secrets: %s\n", redact.Summary(modified.Redactions))
+	}
 	return cv, false, nil
 }
 
@@ -331,11 +821,53 @@ func editMessage(cv conv.Conversation, sha1 string) (conv.Conversation, bool, er
 		return nil, false, fmt.Errorf("failed to change head: %v", err)
 	}
 
-	cv.Append(msg.Role, result)
+	if _, err := cv.Append(msg.Role, result); err != nil {
+		return nil, false, err
+	}
 	return cv, true, nil
 }
 
+// editSystem opens the system prompt of the current branch without comments, as a prompt may contain lines
+// starting with #.
+func editSystem(cv conv.Conversation) (conv.Conversation, bool, error) {
+	result, err := runEditor(cv.GetSystem())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open editor: %v", err)
+	}
+
+	result = strings.TrimSpace(result)
+	if result == "" || result == strings.TrimSpace(cv.GetSystem()) {
+		fmt.Println("System prompt is not changed.")
+		return cv, false, nil
+	}
+
+	system := cv.ChangeSystem(result)
+	fmt.Printf("System prompt [%.6s] is used from the next message. %d versions in this conversation.\n", system.Sha1, len(cv.GetSystems()))
+	return cv, false, nil
+}
+
+// openEditor returns the edited content without the lines starting with #, which are used for comments.
 func openEditor(content string) (string, error) {
+	rawContent, err := runEditor(content)
+	if err != nil {
+		return "", err
+	}
+
+	result := ""
+	for _, d := range strings.Split(rawContent, "\n") {
+		if !strings.HasPrefix(d, "#") {
+			result += d + "\n"
+		}
+	}
+	result = strings.TrimSpace(result)
+	if len(strings.TrimSpace(result)) == 0 {
+		return "", nil
+	}
+
+	return result, nil
+}
+
+func runEditor(content string) (string, error) {
 	tempDir := config.MustGetAskiDir()
 	tmpFile, err := os.CreateTemp(tempDir, "aski-editor-*.txt")
 	if err != nil {
@@ -378,19 +910,7 @@ func openEditor(content string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to read the edited content: %v", err)
 	}
-
-	result := ""
-	for _, d := range strings.Split(string(rawContent), "\n") {
-		if !strings.HasPrefix(d, "#") {
-			result += d + "\n"
-		}
-	}
-	result = strings.TrimSpace(result)
-	if len(strings.TrimSpace(result)) == 0 {
-		return "", nil
-	}
-
-	return result, nil
+	return string(rawContent), nil
 }
 
 func setProfileCustomParamValue(conv conv.Conversation, paramName, paramValue string) (conv.Conversation, error) {
@@ -398,7 +918,7 @@ func setProfileCustomParamValue(conv conv.Conversation, paramName, paramValue st
 
 	matchedParam := ""
 	matched := false
-	for _, param := range []string{"temperature", "stop", "logit_bias", "max_tokens", "top_p", "presence_penalty", "frequency_penalty"} {
+	for _, param := range customParameterNames {
 		if strings.HasPrefix(param, paramName) {
 			if matched {
 				return nil, fmt.Errorf("ambiguous parameter name: %s", paramName)
@@ -476,6 +996,9 @@ func setProfileCustomParamValue(conv conv.Conversation, paramName, paramValue st
 	return conv, nil
 }
 
+// customParameterNames are the parameters :param takes. Names may be given by prefix.
+var customParameterNames = []string{"temperature", "stop", "logit_bias", "max_tokens", "top_p", "presence_penalty", "frequency_penalty"}
+
 func customParametersDescription() string {
 	return `Usage: :param <parameter_name> <parameter_value>
 
@@ -493,7 +1016,7 @@ If parameter_value is not provided, the current parameter value will be displaye
 func displayParameterValue(cp config.CustomParameters, paramName string) {
 	matchedParam := ""
 	matched := false
-	for _, param := range []string{"temperature", "stop", "logit_bias", "max_tokens", "top_p", "presence_penalty", "frequency_penalty"} {
+	for _, param := range customParameterNames {
 		if strings.HasPrefix(param, paramName) {
 			if matched {
 				fmt.Printf("ambiguous parameter name: %s\n", paramName)
@@ -0,0 +1,142 @@
+package command
+
+import (
+	"errors"
+	"github.com/goccy/go-yaml"
+	"github.com/kznrluk/aski/pkg/chat"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMatchCommandKeepsShortForms(t *testing.T) {
+	// Every prefix that ran one of the original commands must still run it. :exit is not meant to be
+	// run by a prefix, see the README.
+	original := []string{":history", ":move", ":config", ":editor", ":modify", ":param", ":exit"}
+	for _, name := range original[:len(original)-1] {
+		for i := 2; i < len(name); i++ {
+			input := name[:i]
+			unique := true
+			for _, other := range original {
+				if other != name && strings.HasPrefix(other, input) {
+					unique = false
+				}
+			}
+			if !unique {
+				continue
+			}
+			if c, ok := matchCommand(input); !ok || c.name != name {
+				t.Errorf("Expected %s to run %s, but got %v", input, name, ok)
+			}
+		}
+	}
+
+	tests := map[string]string{
+		":mode": ":model",
+		":pi":   ":pin",
+		":pr":   ":profile",
+		":com":  ":compact",
+		":ti":   ":title",
+		":ta":   ":tag",
+	}
+	for input, want := range tests {
+		if c, ok := matchCommand(input); !ok || c.name != want {
+			t.Errorf("Expected %s to run %s, but got %v", input, want, ok)
+		}
+	}
+	if _, ok := matchCommand(":t"); ok {
+		t.Errorf("Expected :t to be ambiguous between :title and :tag")
+	}
+}
+
+func TestSwitchModel(t *testing.T) {
+	cfg := config.Config{OpenAIAPIKey: "sk-test"}
+	cv := conv.NewConversation(config.InitialProfile())
+
+	if _, _, err := Parse(":model gpt-4o", cv, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cv.GetProfile().Model; got != "gpt-4o" {
+		t.Errorf("Expected the model to be switched, but got %s", got)
+	}
+
+	_, _, err := Parse(":model claude-3-opus-20240229 anthropic", cv, cfg)
+	if !errors.Is(err, chat.ErrAuth) {
+		t.Errorf("Expected an error without an Anthropic key, but got %v", err)
+	}
+	if got := cv.GetProfile(); got.Model != "gpt-4o" || got.Vendor != "openai" {
+		t.Errorf("Expected the profile to be kept on an error, but got %s %s", got.Vendor, got.Model)
+	}
+}
+
+func TestSwitchProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	profile := config.InitialProfile()
+	profile.ProfileName = "Claude"
+	profile.Vendor = "anthropic"
+	profile.Model = "claude-3-opus-20240229"
+	data, err := yaml.Marshal(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(home, ".aski", "profile")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "claude.yaml"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{AnthropicAPIKey: "sk-test"}
+	cv := conv.NewConversation(config.InitialProfile())
+	cv.SetSystem("Answer in French.")
+
+	if _, _, err := Parse(":profile claude", cv, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cv.GetProfile(); got.ProfileName != "Claude" || got.Vendor != "anthropic" {
+		t.Errorf("Expected the profile to be switched, but got %s %s", got.ProfileName, got.Vendor)
+	}
+	if cv.GetSystem() != "Answer in French." {
+		t.Errorf("Expected the system prompt to be kept, but got %q", cv.GetSystem())
+	}
+
+	if _, _, err := Parse(":profile missing", cv, cfg); !errors.Is(err, config.ErrInvalidConfig) {
+		t.Errorf("Expected an error for a missing profile, but got %v", err)
+	}
+}
+
+func TestEditSystem(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the editor is a shell script")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".aski"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	editor := filepath.Join(home, "editor.sh")
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\nprintf '# Rules\\nBe brief.\\n' > \"$1\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDITOR", editor)
+
+	cv := conv.NewConversation(config.InitialProfile())
+	cv.SetSystem("Be kind.")
+	if _, _, err := Parse(":system", cv, config.Config{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cv.GetSystem(); got != "# Rules\nBe brief." {
+		t.Errorf("Expected the edited system prompt with its heading, but got %q", got)
+	}
+	if len(cv.GetSystems()) != 2 {
+		t.Errorf("Expected the original and the edited versions, but got %d", len(cv.GetSystems()))
+	}
+}
@@ -0,0 +1,289 @@
+package command
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Candidate - A completion of the word before the cursor. Hint is shown next to the value when candidates are listed.
+type Candidate struct {
+	Value string
+	Hint  string
+}
+
+// Complete returns the candidates for the last word of the line, which is the text before the cursor.
+// Each candidate replaces the whole word. The first word completes to a command, and the others by the kind of
+// the argument at their position: messages of the conversation, tags, parameters or paths. Directories end with
+// a separator so that completion can continue into them.
+func Complete(line string, cv conv.Conversation) []Candidate {
+	if !strings.HasPrefix(line, ":") {
+		return nil
+	}
+
+	words, quoted := splitLine(line)
+	word := words[len(words)-1]
+	if len(words) == 1 {
+		return completeCommand(word)
+	}
+
+	matched, found := matchCommand(words[0])
+	if !found {
+		return nil
+	}
+	if strings.HasPrefix(word, "-") && !quoted {
+		return completeFlag(*matched, word)
+	}
+
+	index := 0
+	for _, w := range words[1 : len(words)-1] {
+		if !strings.HasPrefix(w, "--") {
+			index++
+		}
+	}
+
+	a, ok := matched.argAt(index)
+	if !ok {
+		return nil
+	}
+
+	var candidates []Candidate
+	switch a.kind {
+	case argSha1:
+		candidates = completeSha1(cv, word)
+	case argPath:
+		candidates = matchWords(completePath(word), "")
+	case argParam:
+		candidates = matchWords(customParameterNames, word)
+	case argTag:
+		candidates = matchWords(tags(cv), word)
+	case argProfile:
+		candidates = matchWords(profiles(), word)
+	}
+	candidates = append(candidates, matchWords(a.choices, word)...)
+
+	for i := range candidates {
+		candidates[i].Value = quote(candidates[i].Value, quoted)
+	}
+	return candidates
+}
+
+// splitLine splits the line at spaces outside quotes, and removes the quotes. quoted reports whether the
+// last word has an open quote.
+func splitLine(line string) ([]string, bool) {
+	var words []string
+	var b strings.Builder
+	var open rune
+	for _, r := range line {
+		switch {
+		case open != 0 && r == open:
+			open = 0
+		case open == 0 && (r == '"' || r == '\''):
+			open = r
+		case open == 0 && r == ' ':
+			if b.Len() > 0 {
+				words = append(words, b.String())
+				b.Reset()
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return append(words, b.String()), open != 0
+}
+
+// quote puts a value that would be split by Parse in double quotes. The quote is left open after a directory
+// so that completion can continue into it.
+func quote(value string, quoted bool) string {
+	if !quoted && !strings.ContainsAny(value, " \t\"'\\") {
+		return value
+	}
+
+	s := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	if strings.HasSuffix(value, string(filepath.Separator)) {
+		return s
+	}
+	return s + `"`
+}
+
+func completeCommand(word string) []Candidate {
+	var candidates []Candidate
+	for _, c := range availableCommands {
+		if strings.HasPrefix(c.name, word) {
+			hint, _, _ := strings.Cut(c.description, "\n")
+			candidates = append(candidates, Candidate{Value: c.name, Hint: hint})
+		}
+	}
+	return candidates
+}
+
+func completeFlag(c cmd, word string) []Candidate {
+	var flags []string
+	for _, a := range c.args {
+		if a.kind == argFlag {
+			flags = append(append(flags, a.name), a.choices...)
+		}
+	}
+	return matchWords(flags, word)
+}
+
+// completeSha1 lists the messages starting with the word, newest first, with their role and a preview.
+// Values are shortened to six characters like in :history, unless the word is already longer.
+func completeSha1(cv conv.Conversation, word string) []Candidate {
+	messages := cv.GetMessages()
+
+	parents := map[string]bool{}
+	for _, m := range messages {
+		parents[m.ParentSha1] = true
+	}
+
+	var candidates []Candidate
+	seen := map[string]bool{}
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		if !strings.HasPrefix(m.Sha1, word) {
+			continue
+		}
+
+		value := m.Sha1
+		if len(word) < 6 && len(value) > 6 {
+			value = value[:6]
+		}
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+
+		hint := m.Role + ": " + preview(m)
+		if m.Head {
+			hint += " (HEAD)"
+		} else if !parents[m.Sha1] {
+			hint += " (branch)"
+		}
+		candidates = append(candidates, Candidate{Value: value, Hint: hint})
+	}
+	return candidates
+}
+
+// preview returns the first characters of a message on one line, or the label of an attachment.
+func preview(m conv.Message) string {
+	if m.Attachment != nil {
+		return "attached " + m.Attachment.Label()
+	}
+
+	content := strings.Join(strings.Fields(m.Content), " ")
+	if len([]rune(content)) > 40 {
+		content = string([]rune(content)[:40]) + "..."
+	}
+	return content
+}
+
+func tags(cv conv.Conversation) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, m := range cv.GetMessages() {
+		for _, tag := range m.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// profiles lists the profiles without their extension, as :profile finds them either way.
+func profiles() []string {
+	names, err := config.ListProfiles()
+	if err != nil {
+		return nil
+	}
+	for i, name := range names {
+		names[i] = strings.TrimSuffix(name, ".yaml")
+	}
+	return names
+}
+
+func matchWords(words []string, prefix string) []Candidate {
+	var candidates []Candidate
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			candidates = append(candidates, Candidate{Value: w})
+		}
+	}
+	return candidates
+}
+
+// completePath lists the files and directories starting with the word. Hidden files are listed only when the
+// word names them with a leading dot.
+func completePath(word string) []string {
+	dir, base := filepath.Split(expandHome(word))
+
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		candidate := dir + name
+		if isDir(filepath.Join(readDir, name), entry) {
+			candidate += string(filepath.Separator)
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// CommonPrefix returns the longest prefix shared by the values of the candidates.
+func CommonPrefix(candidates []Candidate) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	prefix := []rune(candidates[0].Value)
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c.Value, string(prefix)) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return string(prefix)
+}
+
+// expandHome replaces a leading ~ by the home directory, as paths are not expanded by a shell.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return home + path[1:]
+}
+
+// isDir follows symlinks so that links to directories complete like directories.
+func isDir(path string, entry os.DirEntry) bool {
+	if entry.IsDir() {
+		return true
+	}
+	if entry.Type()&os.ModeSymlink == 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,96 @@
+package command
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func values(candidates []Candidate) []string {
+	var values []string
+	for _, c := range candidates {
+		values = append(values, c.Value)
+	}
+	return values
+}
+
+func TestCompletePath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "main_test.go", ".env", "pkg/conv.go", "my notes.md"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sep := string(filepath.Separator)
+	cv := conv.NewConversation(config.InitialProfile())
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{":attach " + dir + sep + "ma", []string{dir + sep + "main.go", dir + sep + "main_test.go"}},
+		{":att a.go " + dir + sep + "p", []string{dir + sep + "pkg" + sep}},
+		{":attach " + dir + sep + ".", []string{dir + sep + ".env"}},
+		{":attach " + dir + sep + "my", []string{`"` + dir + sep + `my notes.md"`}},
+		{`:attach "` + dir + sep + "my n", []string{`"` + dir + sep + `my notes.md"`}},
+		{":export md " + dir + sep + "p", []string{dir + sep + "pkg" + sep}},
+		{":attach " + dir + sep + "x", nil},
+		{":history " + dir + sep, nil},
+		{"hello " + dir + sep, nil},
+	}
+	for _, tt := range tests {
+		if got := values(Complete(tt.line, cv)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Complete(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	cv := conv.NewConversation(config.InitialProfile())
+	question, _ := cv.Append(conv.ChatRoleUser, "what is a pipe?")
+	answer, _ := cv.Append(conv.ChatRoleAssistant, "a way to chain commands")
+	answer.Tags = []string{"good"}
+	if err := cv.Modify(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{":ex", []string{":export", ":exit"}},
+		{":move ", []string{answer.Sha1[:6], question.Sha1[:6]}},
+		{":move " + question.Sha1[:2], []string{question.Sha1[:6]}},
+		{":move " + question.Sha1[:8], []string{question.Sha1}},
+		{":editor " + answer.Sha1[:3], []string{answer.Sha1[:6]}},
+		{":editor l", []string{"latest"}},
+		{":param te", []string{"temperature"}},
+		{":param temperature ", nil},
+		{":untag g", []string{"good"}},
+		{":export j", []string{"json"}},
+		{":export --", []string{"--all"}},
+		{":refresh a", []string{"append"}},
+		{":pin abc ", nil},
+	}
+	for _, tt := range tests {
+		if got := values(Complete(tt.line, cv)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Complete(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+
+	hints := Complete(":move ", cv)
+	if hints[0].Hint != "assistant: a way to chain commands (HEAD)" || hints[1].Hint != "user: what is a pipe?" {
+		t.Errorf("Unexpected hints: %+v", hints)
+	}
+
+	if got := CommonPrefix([]Candidate{{Value: "main.go"}, {Value: "main_test.go"}}); got != "main" {
+		t.Errorf("Unexpected common prefix: %q", got)
+	}
+}
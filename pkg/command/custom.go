@@ -0,0 +1,214 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kballard/go-shellquote"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"strings"
+	"text/template"
+)
+
+// maxCustomDepth limits custom commands running other custom commands, so that a command calling itself stops.
+const maxCustomDepth = 8
+
+var (
+	customDepth = 0
+
+	errNestedTooDeep = fmt.Errorf("custom commands are nested more than %d levels", maxCustomDepth)
+)
+
+// Register adds the commands defined in the config and the profile to the inline commands, replacing those
+// registered before. A command of the profile replaces the command of the config with the same name.
+func Register(cfg config.Config, profile config.Profile) error {
+	var commands []cmd
+	builtin := map[string]bool{}
+	for _, c := range availableCommands {
+		if c.custom {
+			continue
+		}
+		commands = append(commands, c)
+		builtin[c.name] = true
+		for _, alias := range c.aliases {
+			builtin[alias] = true
+		}
+	}
+
+	var names []string
+	defs := map[string]config.Command{}
+	for _, def := range append(append([]config.Command{}, cfg.Commands...), profile.Commands...) {
+		if builtin[def.Name] {
+			return fmt.Errorf("%w: command %s is a built-in command", config.ErrInvalidConfig, def.Name)
+		}
+		if _, ok := defs[def.Name]; !ok {
+			names = append(names, def.Name)
+		}
+		defs[def.Name] = def
+	}
+
+	for _, name := range names {
+		commands = append(commands, customCommand(defs[name]))
+	}
+	availableCommands = commands
+
+	// Aliases of commands taking text, such as :title, take the rest of the line as typed too.
+	for i, c := range availableCommands {
+		if c.custom && aliasOfText(defs[c.name].Alias) {
+			availableCommands[i].args = []arg{{name: "text", kind: argText, optional: true}}
+		}
+	}
+	return nil
+}
+
+// aliasOfText reports whether the alias runs a command taking the rest of the line as text.
+func aliasOfText(alias string) bool {
+	fields := strings.Fields(alias)
+	if len(fields) == 0 {
+		return false
+	}
+	target, found := matchCommand(fields[0])
+	return found && len(target.args) == 1 && target.args[0].kind == argText
+}
+
+func customCommand(def config.Command) cmd {
+	description := def.Description
+	if description == "" {
+		switch {
+		case def.Alias != "":
+			description = fmt.Sprintf("Alias of %s.", def.Alias)
+		case len(def.Steps) > 0:
+			description = fmt.Sprintf("Run %s.", strings.Join(def.Steps, ", then "))
+		default:
+			description = "Send the prompt defined in the config."
+		}
+	}
+
+	return cmd{
+		name:        def.Name,
+		args:        []arg{{name: "args", optional: true, variadic: true}},
+		description: strings.ReplaceAll(strings.TrimSpace(description), "\n", "\n                   "),
+		custom:      true,
+		exec: func(commands []string, cv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+			return runCustom(def, commands[1:], cv, cfg)
+		},
+	}
+}
+
+func runCustom(def config.Command, args []string, cv conv.Conversation, cfg config.Config) (conv.Conversation, bool, error) {
+	if customDepth >= maxCustomDepth {
+		return nil, false, fmt.Errorf("%w, at %s", errNestedTooDeep, def.Name)
+	}
+	customDepth++
+	defer func() { customDepth-- }()
+
+	if def.Alias != "" {
+		if aliasOfText(def.Alias) {
+			return Parse(def.Alias+" "+strings.Join(args, " "), cv, cfg)
+		}
+		return Parse(def.Alias+" "+shellquote.Join(args...), cv, cfg)
+	}
+
+	cont := false
+	for _, step := range def.Steps {
+		line, err := expand(step, args, cv)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %v", def.Name, err)
+		}
+
+		next, c, err := Parse(line, cv, cfg)
+		if errors.Is(err, errNestedTooDeep) {
+			return nil, false, err
+		} else if err != nil {
+			return nil, false, fmt.Errorf("%s: %s: %w", def.Name, strings.TrimSpace(line), err)
+		}
+		if next != nil {
+			cv = next
+		}
+		cont = cont || c
+	}
+
+	if def.Prompt == "" {
+		return cv, cont, nil
+	}
+
+	prompt, err := expand(def.Prompt, args, cv)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %v", def.Name, err)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return nil, false, fmt.Errorf("%s: the prompt is empty", def.Name)
+	}
+	if _, err := cv.Append(conv.ChatRoleUser, prompt); err != nil {
+		return nil, false, err
+	}
+	return cv, true, nil
+}
+
+// templateData is given to Prompt and Steps. Reply and Code fail the template when there is nothing to use,
+// rather than sending an empty block.
+type templateData struct {
+	Args  []string
+	Input string
+	cv    conv.Conversation
+}
+
+func (d templateData) Reply() (string, error) {
+	messages := d.cv.MessagesFromHead()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == conv.ChatRoleAssistant && messages[i].Attachment == nil {
+			return messages[i].Content, nil
+		}
+	}
+	return "", errors.New("no reply on the current branch")
+}
+
+func (d templateData) Code() (string, error) {
+	reply, err := d.Reply()
+	if err != nil {
+		return "", err
+	}
+	code, ok := lastCodeBlock(reply)
+	if !ok {
+		return "", errors.New("no code block in the last reply")
+	}
+	return code, nil
+}
+
+func expand(text string, args []string, cv conv.Conversation) (string, error) {
+	t, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	data := templateData{Args: args, Input: strings.Join(args, " "), cv: cv}
+	if err := t.Execute(&b, data); err != nil {
+		var execErr template.ExecError
+		if errors.As(err, &execErr) && errors.Unwrap(execErr.Err) != nil {
+			return "", errors.Unwrap(execErr.Err)
+		}
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// lastCodeBlock returns the contents of the last fenced code block, without the fences.
+func lastCodeBlock(content string) (string, bool) {
+	var block, current []string
+	found, open := false, false
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if open {
+				block, found = current, true
+			}
+			open = !open
+			current = nil
+			continue
+		}
+		if open {
+			current = append(current, line)
+		}
+	}
+	return strings.Join(block, "\n"), found
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"errors"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func register(t *testing.T, cfg config.Config, profile config.Profile) {
+	t.Helper()
+	if err := Register(cfg, profile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = Register(config.Config{}, config.Profile{}) })
+}
+
+func TestRegister(t *testing.T) {
+	cfg := config.Config{Commands: []config.Command{
+		{Name: ":fav", Alias: ":tag favorite"},
+		{Name: ":review", Prompt: "Review this."},
+	}}
+	profile := config.Profile{Commands: []config.Command{{Name: ":review", Prompt: "Review this in detail."}}}
+	register(t, cfg, profile)
+
+	c := command(t, ":fa")
+	if c.name != ":fav" || c.description != "Alias of :tag favorite." {
+		t.Errorf("Expected :fa to match the alias by prefix, but got %s: %s", c.name, c.description)
+	}
+
+	cv := conv.NewConversation(config.InitialProfile())
+	if _, _, err := Parse(":review", cv, config.Config{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cv.Last().Content; got != "Review this in detail." {
+		t.Errorf("Expected the command of the profile to replace the config, but got %q", got)
+	}
+
+	register(t, config.Config{}, config.Profile{})
+	if _, ok := matchCommand(":fav"); ok {
+		t.Errorf("Expected registering again to remove previous commands")
+	}
+
+	err := Register(config.Config{Commands: []config.Command{{Name: ":quit", Alias: ":history"}}}, config.Profile{})
+	if !errors.Is(err, config.ErrInvalidConfig) {
+		t.Errorf("Expected an error for a built-in name, but got %v", err)
+	}
+}
+
+func TestRunCustom(t *testing.T) {
+	register(t, config.Config{Commands: []config.Command{
+		{Name: ":fav", Alias: ":tag"},
+		{Name: ":name", Alias: ":title"},
+		{Name: ":explain", Prompt: "Explain {{.Input}}:\n{{.Code}}"},
+		{Name: ":mark", Steps: []string{":tag {{index .Args 0}}", ":pin {{index .Args 1}}"}, Prompt: "Marked."},
+		{Name: ":loop", Steps: []string{":loop"}},
+	}}, config.Profile{})
+
+	cv := conv.NewConversation(config.InitialProfile())
+	if _, _, err := Parse(":explain briefly", cv, config.Config{}); err == nil || !strings.Contains(err.Error(), "no reply") {
+		t.Errorf("Expected an error without a reply, but got %v", err)
+	}
+
+	question, _ := cv.Append(conv.ChatRoleUser, "Write hello world.")
+	_, _ = cv.Append(conv.ChatRoleAssistant, "Here:\n```go\nfmt.Println(\"hello\")\n```\nDone.")
+
+	if _, _, err := Parse(`:fav "good one"`, cv, config.Config{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cv.Last().Tags; !reflect.DeepEqual(got, []string{"good one"}) {
+		t.Errorf("Expected the alias to pass quoted arguments, but got %q", got)
+	}
+
+	if _, _, err := Parse(`:name it's "done"`, cv, config.Config{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := cv.GetTitle(), `it's "done"`; got != want {
+		t.Errorf("Expected the alias to pass the text as typed, %q, but got %q", want, got)
+	}
+
+	_, cont, err := Parse(":explain briefly", cv, config.Config{})
+	if err != nil || !cont {
+		t.Fatalf("Expected the prompt to be sent, but got %v, %v", cont, err)
+	}
+	if got, want := cv.Last().Content, "Explain briefly:\nfmt.Println(\"hello\")"; got != want {
+		t.Errorf("Expected %q, but got %q", want, got)
+	}
+
+	if _, _, err := Parse(":mark keep "+question.Sha1[:6], cv, config.Config{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pinned, _ := cv.GetMessageFromSha1(question.Sha1)
+	if !pinned.Pinned || cv.Last().Content != "Marked." {
+		t.Errorf("Expected the steps to run before the prompt")
+	}
+
+	if _, _, err := Parse(":loop", cv, config.Config{}); !errors.Is(err, errNestedTooDeep) {
+		t.Errorf("Expected an error for a command running itself, but got %v", err)
+	}
+}
+
+func TestLastCodeBlock(t *testing.T) {
+	code, ok := lastCodeBlock("```\na\n```\ntext\n```sh\nb\nc\n```")
+	if !ok || code != "b\nc" {
+		t.Errorf("Expected the last block, but got %q, %v", code, ok)
+	}
+	if _, ok := lastCodeBlock("no code\n```\nunterminated"); ok {
+		t.Errorf("Expected no block")
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Command - An inline command defined in the config or a profile.
+//
+//	Alias  - Run another command, such as `:export md`, with the arguments appended.
+//	Prompt - Send a user message. The text is a template, see below.
+//	Steps  - Run inline commands in order, then send Prompt if it is set.
+//
+// Prompt and Steps are Go templates with .Args, the arguments of the command, .Input, the arguments joined by
+// spaces, .Reply, the last reply of the assistant on the current branch, and .Code, the last code block of it.
+type Command struct {
+	Name        string   `yaml:"Name"`
+	Description string   `yaml:"Description,omitempty"`
+	Alias       string   `yaml:"Alias,omitempty"`
+	Prompt      string   `yaml:"Prompt,omitempty"`
+	Steps       []string `yaml:"Steps,omitempty"`
+}
+
+var commandNamePattern = regexp.MustCompile(`^:[^\s:]\S*$`)
+
+func validateCommands(commands []Command) error {
+	seen := map[string]bool{}
+	for _, c := range commands {
+		if !commandNamePattern.MatchString(c.Name) {
+			return fmt.Errorf("command Name must start with : and must not contain spaces, but got: %q", c.Name)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("command %s is defined twice", c.Name)
+		}
+		seen[c.Name] = true
+
+		if c.Alias != "" && (c.Prompt != "" || len(c.Steps) > 0) {
+			return fmt.Errorf("command %s: Alias cannot be combined with Prompt or Steps", c.Name)
+		}
+		if c.Alias == "" && c.Prompt == "" && len(c.Steps) == 0 {
+			return fmt.Errorf("command %s: one of Alias, Prompt or Steps must be set", c.Name)
+		}
+		if c.Alias != "" && !strings.HasPrefix(c.Alias, ":") {
+			return fmt.Errorf("command %s: Alias must be an inline command, but got: %s", c.Name, c.Alias)
+		}
+
+		for _, step := range c.Steps {
+			if !strings.HasPrefix(strings.TrimSpace(step), ":") {
+				return fmt.Errorf("command %s: Steps must be inline commands, but got: %s", c.Name, step)
+			}
+			if _, err := template.New(c.Name).Parse(step); err != nil {
+				return fmt.Errorf("command %s: %v", c.Name, err)
+			}
+		}
+		if _, err := template.New(c.Name).Parse(c.Prompt); err != nil {
+			return fmt.Errorf("command %s: %v", c.Name, err)
+		}
+	}
+	return nil
+}
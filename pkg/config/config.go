@@ -2,6 +2,7 @@ package config
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
 	"github.com/goccy/go-yaml"
 	"io"
@@ -12,10 +13,50 @@ import (
 	"runtime"
 )
 
+// ErrInvalidConfig is returned when the config or a profile cannot be read or is not valid.
+var ErrInvalidConfig = errors.New("invalid config")
+
 type Config struct {
 	OpenAIAPIKey    string `yaml:"OpenAIAPIKey"`
 	AnthropicAPIKey string `yaml:"AnthropicAPIKey"`
 	CurrentProfile  string `yaml:"CurrentProfile"`
+
+	// History is the retention policy of saved conversations.
+	History HistoryPolicy `yaml:"History,omitempty"`
+	// Encryption encrypts saved conversations with age.
+	Encryption Encryption `yaml:"Encryption,omitempty"`
+	// Commands are inline commands available with every profile.
+	Commands []Command `yaml:"Commands,omitempty"`
+}
+
+// Encryption - How conversations are encrypted at rest. With KeyFile, the age identity in the file is used.
+// Otherwise a key protected by a passphrase is generated in .aski/history-key.age on first use.
+type Encryption struct {
+	// Enabled encrypts conversations and history indexes when they are saved.
+	Enabled bool `yaml:"Enabled,omitempty"`
+	// KeyFile is the path of an age identity file created with age-keygen.
+	KeyFile string `yaml:"KeyFile,omitempty"`
+}
+
+// HistoryPolicy - Which conversations `aski history prune` removes. Conversations matching
+// MaxAge or beyond MaxCount are removed unless they are kept by KeepTagged.
+type HistoryPolicy struct {
+	// MaxAge removes conversations not updated for this long, such as 90d or 2w.
+	MaxAge string `yaml:"MaxAge,omitempty"`
+	// MaxCount keeps at most this many of the most recently updated conversations. 0 keeps all.
+	MaxCount int `yaml:"MaxCount,omitempty"`
+	// KeepTagged keeps conversations containing messages tagged with :tag.
+	KeepTagged bool `yaml:"KeepTagged,omitempty"`
+	// Archive bundles conversations into .aski/archive before they are removed.
+	Archive bool `yaml:"Archive,omitempty"`
+	// AutoPrune applies the policy every time aski starts.
+	AutoPrune bool `yaml:"AutoPrune,omitempty"`
+}
+
+func MustGetArchiveDir() string {
+	str := MustGetAskiDir()
+
+	return filepath.Join(str, "archive")
 }
 
 func InitialConfig() Config {
@@ -112,26 +153,30 @@ func GetConfig() (Config, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		err := CreateInitialConfigFiles()
 		if err != nil {
-			return Config{}, err
+			return Config{}, fmt.Errorf("%w: cannot create %s: %v", ErrInvalidConfig, configPath, err)
 		}
 	}
 
 	configFile, err := os.Open(configPath)
 	if err != nil {
-		return Config{}, err
+		return Config{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 	}
 
 	defer configFile.Close()
 
 	configBytes, err := io.ReadAll(configFile)
 	if err != nil {
-		return Config{}, err
+		return Config{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 	}
 
 	var config Config
 	err = yaml.Unmarshal(configBytes, &config)
 	if err != nil {
-		return Config{}, err
+		return Config{}, fmt.Errorf("%w: cannot parse %s: %v", ErrInvalidConfig, configPath, err)
+	}
+
+	if err := validateCommands(config.Commands); err != nil {
+		return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, configPath, err)
 	}
 
 	if config.CurrentProfile == "" {
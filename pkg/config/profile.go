@@ -4,12 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"github.com/goccy/go-yaml"
+	"github.com/kznrluk/aski/pkg/token"
 	"github.com/sashabaranov/go-openai"
 	"io"
 	"os"
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -24,6 +26,26 @@ type Profile struct {
 	Messages         []PreMessage     `yaml:"Messages"`
 	CustomParameters CustomParameters `yaml:"CustomParameters,omitempty"`
 
+	// AutoCompact summarizes older messages automatically when the request would exceed the context window.
+	AutoCompact bool `yaml:"AutoCompact,omitempty"`
+	// ContextWindow overrides the context window size in tokens known for the model.
+	ContextWindow int `yaml:"ContextWindow,omitempty"`
+	// ContextStrategy controls which messages of the current branch are sent.
+	ContextStrategy ContextStrategy `yaml:"ContextStrategy,omitempty"`
+
+	// AutoTitle names the conversation after the first exchange.
+	AutoTitle bool `yaml:"AutoTitle,omitempty"`
+	// TitleModel is the model used to generate titles, such as a cheaper one. Defaults to Model.
+	TitleModel string `yaml:"TitleModel,omitempty"`
+
+	// Redaction replaces secrets in user messages and attached files before they are sent and saved.
+	Redaction Redaction `yaml:"Redaction,omitempty"`
+	// Attachments limits the size of files attached with -f.
+	Attachments AttachmentLimits `yaml:"Attachments,omitempty"`
+
+	// Commands are inline commands available with this profile. They replace commands of the config with the same name.
+	Commands []Command `yaml:"Commands,omitempty"`
+
 	DiceRoll string `yaml:"DiceRoll,omitempty"`
 }
 
@@ -33,11 +55,147 @@ func (p Profile) GetResponseFormat() *openai.ChatCompletionResponseFormat {
 	}
 }
 
+// defaultReservedTokens is kept free for the response when max_tokens is not set.
+const defaultReservedTokens = 4096
+
+func (p Profile) GetContextWindow() int {
+	if p.ContextWindow > 0 {
+		return p.ContextWindow
+	}
+	return token.ContextWindow(p.Model)
+}
+
+// GetRequestBudget returns the number of tokens available for the request after reserving room for the response.
+func (p Profile) GetRequestBudget() int {
+	window := p.GetContextWindow()
+	reserved := p.CustomParameters.MaxTokens
+	if reserved == 0 {
+		reserved = defaultReservedTokens
+	}
+	if reserved > window/2 {
+		reserved = window / 2
+	}
+	return window - reserved
+}
+
+// Redaction - Secrets such as API keys, AWS credentials, private keys and JWTs are redacted by default.
+// Patterns adds regular expressions. When a pattern has a capturing group, only the group is redacted.
+type Redaction struct {
+	Disabled bool            `yaml:"Disabled,omitempty"`
+	Patterns []RedactPattern `yaml:"Patterns,omitempty"`
+}
+
+type RedactPattern struct {
+	Name  string `yaml:"Name"`
+	Regex string `yaml:"Regex"`
+}
+
 type PreMessage struct {
 	Role    string `yaml:"Role"`
 	Content string `yaml:"Content"`
 }
 
+const (
+	ContextStrategyAll             = ""
+	ContextStrategyLast            = "last"
+	ContextStrategyFirstLast       = "first_last"
+	ContextStrategyDropAttachments = "drop_attachments"
+	ContextStrategyBudget          = "budget"
+)
+
+// ContextStrategy - Trims the messages sent to the API. Turns start at a user message.
+//
+//	last             - Send the last KeepLast turns.
+//	first_last       - Send the first KeepFirst turns and the last KeepLast turns.
+//	drop_attachments - Drop file attachments from the oldest until the request fits in TokenBudget.
+//	budget           - Send the newest turns that fit in TokenBudget, always keeping the first KeepFirst turns.
+type ContextStrategy struct {
+	Type        string `yaml:"Type,omitempty"`
+	KeepFirst   int    `yaml:"KeepFirst,omitempty"`
+	KeepLast    int    `yaml:"KeepLast,omitempty"`
+	TokenBudget int    `yaml:"TokenBudget,omitempty"`
+}
+
+const (
+	AttachmentStrategyRefuse   = "refuse"
+	AttachmentStrategyTruncate = "truncate"
+	AttachmentStrategyHeadTail = "headtail"
+)
+
+// AttachmentLimits - Budgets for attached files, such as 64KB, 1MB or 8000tokens. Empty values are unlimited.
+//
+//	refuse   - Stop with an error when a file or the total exceeds its budget. This is the default.
+//	truncate - Keep the beginning of the file.
+//	headtail - Keep the beginning and the end of the file, dropping the middle.
+type AttachmentLimits struct {
+	MaxFileSize  string `yaml:"MaxFileSize,omitempty"`
+	MaxTotalSize string `yaml:"MaxTotalSize,omitempty"`
+	Strategy     string `yaml:"Strategy,omitempty"`
+}
+
+// Size - A budget in bytes or in estimated tokens. Zero is unlimited.
+type Size struct {
+	Bytes  int
+	Tokens int
+}
+
+var sizePattern = regexp.MustCompile(`^(?i)\s*(\d+)\s*(b|kb|k|mb|m|t|tokens?)?\s*$`)
+
+// ParseSize parses sizes such as 2048, 64KB, 1MB or 8000tokens. KB and MB are powers of 1024.
+func ParseSize(s string) (Size, error) {
+	if strings.TrimSpace(s) == "" {
+		return Size{}, nil
+	}
+
+	m := sizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return Size{}, fmt.Errorf("invalid size: %s, use bytes such as 64KB or tokens such as 8000tokens", s)
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return Size{}, fmt.Errorf("invalid size: %s", s)
+	}
+
+	switch strings.ToLower(m[2]) {
+	case "", "b":
+		return Size{Bytes: n}, nil
+	case "kb", "k":
+		return Size{Bytes: n * 1024}, nil
+	case "mb", "m":
+		return Size{Bytes: n * 1024 * 1024}, nil
+	default:
+		return Size{Tokens: n}, nil
+	}
+}
+
+func (s Size) IsZero() bool {
+	return s.Bytes == 0 && s.Tokens == 0
+}
+
+func (s Size) String() string {
+	if s.Tokens > 0 {
+		return fmt.Sprintf("%d tokens", s.Tokens)
+	}
+	return fmt.Sprintf("%d bytes", s.Bytes)
+}
+
+func validateAttachmentLimits(l AttachmentLimits) error {
+	if _, err := ParseSize(l.MaxFileSize); err != nil {
+		return fmt.Errorf("Attachments MaxFileSize: %v", err)
+	}
+	if _, err := ParseSize(l.MaxTotalSize); err != nil {
+		return fmt.Errorf("Attachments MaxTotalSize: %v", err)
+	}
+
+	switch l.Strategy {
+	case "", AttachmentStrategyRefuse, AttachmentStrategyTruncate, AttachmentStrategyHeadTail:
+		return nil
+	default:
+		return fmt.Errorf("unknown Attachments Strategy: %s, must be refuse, truncate or headtail", l.Strategy)
+	}
+}
+
 // CustomParameters - When these parameters are specified, they will be overwritten during transmission.
 type CustomParameters struct {
 	MaxTokens        int            `yaml:"max_tokens,omitempty"`
@@ -59,7 +217,7 @@ func GetProfile(cfg Config, overload string) (Profile, error) {
 	if !hasDefaultProfile() {
 		err := CreateInitialProfileFile()
 		if err != nil {
-			return Profile{}, fmt.Errorf("cannot create initial profile file: %s", err)
+			return Profile{}, fmt.Errorf("%w: cannot create initial profile file: %v", ErrInvalidConfig, err)
 		}
 	}
 	// We called hasDefaultProfile() above, so we know that the default profile exists
@@ -73,19 +231,19 @@ func GetProfile(cfg Config, overload string) (Profile, error) {
 
 		profileFile, err := os.Open(target)
 		if err != nil {
-			return Profile{}, fmt.Errorf("cannot open profile file: %s", err)
+			return Profile{}, fmt.Errorf("%w: cannot open profile file: %v", ErrInvalidConfig, err)
 		}
 		defer profileFile.Close()
 
 		profileBytes, err := io.ReadAll(profileFile)
 		if err != nil {
-			return Profile{}, fmt.Errorf("cannot read profile file: %s", err)
+			return Profile{}, fmt.Errorf("%w: cannot read profile file: %v", ErrInvalidConfig, err)
 		}
 
 		var profile Profile
 		err = yaml.Unmarshal(profileBytes, &profile)
 		if err != nil {
-			return Profile{}, fmt.Errorf("cannot parse profile file: %s", err)
+			return Profile{}, fmt.Errorf("%w: cannot parse profile file %s: %v", ErrInvalidConfig, target, err)
 		}
 
 		migrated, changed := migrateProfile(profile)
@@ -102,14 +260,14 @@ func GetProfile(cfg Config, overload string) (Profile, error) {
 		}
 
 		// Validate the loaded profile
-		if err := validateProfile(migrated); err != nil {
-			return Profile{}, fmt.Errorf("invalid profile %s: %s", target, err)
+		if err := ValidateProfile(migrated); err != nil {
+			return Profile{}, fmt.Errorf("%w: profile %s: %v", ErrInvalidConfig, target, err)
 		}
 
 		return migrated, nil
 	}
 
-	return Profile{}, fmt.Errorf("profile file not found, tried: %s", strings.Join(toSearchPaths, ", "))
+	return Profile{}, fmt.Errorf("%w: profile file not found, tried: %s", ErrInvalidConfig, strings.Join(toSearchPaths, ", "))
 }
 
 func createToSearchPaths(profileDir string, cfg Config, overload string) []string {
@@ -134,6 +292,22 @@ func createToSearchPaths(profileDir string, cfg Config, overload string) []strin
 	return toSearchPaths
 }
 
+// ListProfiles returns the file names of the profiles in the profile directory.
+func ListProfiles() ([]string, error) {
+	entries, err := os.ReadDir(MustGetProfileDir())
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read the profile directory: %v", ErrInvalidConfig, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".yaml") && entry.Name() != "config.yaml" {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
 func hasDefaultProfile() bool {
 	profileDir := MustGetProfileDir()
 	defaultProfilePath := filepath.Join(profileDir, "default.yaml")
@@ -182,7 +356,8 @@ func InitialProfile() Profile {
 	}
 }
 
-func validateProfile(profile Profile) error {
+// ValidateProfile reports the first invalid value of the profile.
+func ValidateProfile(profile Profile) error {
 	if profile.ProfileName == "" {
 		return fmt.Errorf("ProfileName must not be empty")
 	}
@@ -198,6 +373,26 @@ func validateProfile(profile Profile) error {
 	if profile.Vendor == "" {
 		return fmt.Errorf("vendor must not be empty")
 	}
+	if profile.ContextWindow < 0 {
+		return fmt.Errorf("ContextWindow must not be negative")
+	}
+	if err := validateContextStrategy(profile.ContextStrategy); err != nil {
+		return err
+	}
+	if err := validateAttachmentLimits(profile.Attachments); err != nil {
+		return err
+	}
+	if err := validateCommands(profile.Commands); err != nil {
+		return err
+	}
+	for _, p := range profile.Redaction.Patterns {
+		if p.Name == "" {
+			return fmt.Errorf("Redaction pattern Name must not be empty")
+		}
+		if _, err := regexp.Compile(p.Regex); err != nil {
+			return fmt.Errorf("invalid Redaction pattern %s: %v", p.Name, err)
+		}
+	}
 
 	for _, message := range profile.Messages {
 		if message.Role == "" {
@@ -206,6 +401,9 @@ func validateProfile(profile Profile) error {
 		if message.Content == "" {
 			return fmt.Errorf("message Content must not be empty")
 		}
+		if role := strings.ToLower(message.Role); role != "user" && role != "assistant" {
+			return fmt.Errorf("message Role must be user or assistant, but got: %s", message.Role)
+		}
 	}
 
 	if profile.ResponseFormat != string(openai.ChatCompletionResponseFormatTypeJSONObject) &&
@@ -222,7 +420,6 @@ func validateProfile(profile Profile) error {
 		if !re.MatchString(profile.DiceRoll) {
 			return fmt.Errorf("DiceRoll must match the format of XdY (ex: 3d6, 1d100), but got: %s", profile.DiceRoll)
 		}
-		return nil
 	}
 
 	return ValidateCustomParameters(profile.CustomParameters)
@@ -240,6 +437,24 @@ func migrateProfile(profile Profile) (Profile, bool) {
 	return profile, changed
 }
 
+func validateContextStrategy(s ContextStrategy) error {
+	if s.KeepFirst < 0 || s.KeepLast < 0 || s.TokenBudget < 0 {
+		return fmt.Errorf("ContextStrategy values must not be negative")
+	}
+
+	switch s.Type {
+	case ContextStrategyAll, ContextStrategyDropAttachments, ContextStrategyBudget:
+		return nil
+	case ContextStrategyLast, ContextStrategyFirstLast:
+		if s.KeepLast == 0 {
+			return fmt.Errorf("ContextStrategy %s requires KeepLast", s.Type)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown ContextStrategy Type: %s", s.Type)
+	}
+}
+
 func ValidateCustomParameters(customParams CustomParameters) error {
 	if customParams.Temperature != 0 && (customParams.Temperature < 0 || customParams.Temperature > 2) {
 		return errors.New("temperature must be between 0 and 2")
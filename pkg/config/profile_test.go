@@ -52,3 +52,69 @@ func TestCreateToSearchPaths(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]Size{
+		"":           {},
+		"2048":       {Bytes: 2048},
+		"64KB":       {Bytes: 64 * 1024},
+		"1mb":        {Bytes: 1024 * 1024},
+		"8000tokens": {Tokens: 8000},
+		"500 t":      {Tokens: 500},
+	}
+	for input, expected := range tests {
+		size, err := ParseSize(input)
+		if err != nil || size != expected {
+			t.Errorf("ParseSize(%q) = %+v, %v, expected %+v", input, size, err, expected)
+		}
+	}
+
+	if _, err := ParseSize("lots"); err == nil {
+		t.Errorf("Expected an error for an invalid size")
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	profile := InitialProfile()
+	profile.Messages = []PreMessage{{Role: "System", Content: "be brief"}}
+	if err := ValidateProfile(profile); err == nil {
+		t.Errorf("Expected an error for a message role other than user or assistant")
+	}
+
+	profile = InitialProfile()
+	profile.DiceRoll = "1d6"
+	profile.CustomParameters.Temperature = 3
+	if err := ValidateProfile(profile); err == nil {
+		t.Errorf("Expected custom parameters to be validated with DiceRoll set")
+	}
+}
+
+func TestValidateCommands(t *testing.T) {
+	valid := []Command{
+		{Name: ":r", Alias: ":refresh"},
+		{Name: ":explain", Prompt: "Explain this code.\n{{.Code}}"},
+		{Name: ":review", Steps: []string{":gitdiff --staged"}, Prompt: "Review the changes."},
+	}
+	if err := validateCommands(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := map[string]Command{
+		"name without colon": {Name: "r", Alias: ":refresh"},
+		"name with a space":  {Name: ":my cmd", Alias: ":refresh"},
+		"nothing to run":     {Name: ":r"},
+		"alias and prompt":   {Name: ":r", Alias: ":refresh", Prompt: "hi"},
+		"alias not command":  {Name: ":r", Alias: "refresh"},
+		"step not command":   {Name: ":r", Steps: []string{"hello"}},
+		"broken template":    {Name: ":r", Prompt: "{{.Code"},
+	}
+	for name, c := range invalid {
+		if err := validateCommands([]Command{c}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := validateCommands([]Command{valid[0], valid[0]}); err == nil {
+		t.Errorf("Expected an error for a command defined twice")
+	}
+}
@@ -8,11 +8,15 @@ import (
 	"github.com/fatih/color"
 	"github.com/goccy/go-yaml"
 	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/redact"
+	"github.com/kznrluk/aski/pkg/token"
 	"github.com/kznrluk/aski/pkg/util"
 	"github.com/kznrluk/go-anthropic"
 	"github.com/sashabaranov/go-openai"
 	"log/slog"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 type (
@@ -22,14 +26,26 @@ type (
 		GetRootMessage() (Message, error)
 		Last() Message
 		MessagesFromHead() []Message
-		Append(role string, message string) Message
+		MessagesTo(sha1partial string) ([]Message, error)
+		RequestMessages() (kept []Message, excluded []Message)
+		Append(role string, message string) (Message, error)
+		AppendAttachment(attachment Attachment, contents string) (Message, error)
+		ReplaceAttachments(updates []AttachmentUpdate) (Message, error)
+		Detach(sha1partial string) (Message, error)
 		SetSystem(message string)
 		GetSystem() string
+		ChangeSystem(message string) SystemPrompt
+		GetSystems() []SystemPrompt
+		SystemOf(m Message) string
 		GetFilename() string
+		GetTitle() string
+		SetTitle(title string)
+		GetSource() string
 		SetProfile(profile config.Profile) error
 		Modify(m Message) error
+		Compact(summary string, keepFrom string) (Message, error)
 		ToOpenAIMessage() []openai.ChatCompletionMessage
-		ToAnthropicMessage() []anthropic.Message
+		ToAnthropicMessage() ([]anthropic.Message, error)
 		ChangeHead(sha string) (Message, error)
 		GetProfile() config.Profile
 		ToYAML() ([]byte, error)
@@ -38,11 +54,24 @@ type (
 
 	conv struct {
 		Filename string `yaml:"-"`
+		Title    string `yaml:",omitempty"`
+		// Source identifies the conversation an imported history was created from.
+		Source   string `yaml:",omitempty"`
 		Profile  config.Profile
 		System   string
+		Systems  []SystemPrompt `yaml:",omitempty"`
 		Messages []Message
 	}
 
+	// SystemPrompt - A version of the system prompt. Systems of a conversation start with the original one once
+	// it is changed with ChangeSystem. Messages sent under another version record it in System, so that each
+	// branch keeps the system prompt it was generated under. The System of the conversation is the one of HEAD.
+	SystemPrompt struct {
+		Sha1      string
+		Content   string    `yaml:"content,literal"`
+		CreatedAt time.Time `yaml:",omitempty"`
+	}
+
 	Message struct {
 		Sha1       string
 		ParentSha1 string
@@ -50,6 +79,40 @@ type (
 		Content    string `yaml:"content,literal"`
 		UserName   string
 		Head       bool
+		CreatedAt  time.Time `yaml:",omitempty"`
+		// Model and Profile record what produced an assistant reply, as they can be switched during a conversation.
+		Model   string `yaml:",omitempty"`
+		Profile string `yaml:",omitempty"`
+		// System is the SHA1 of the system prompt version the message was sent with. Empty for the original one.
+		System     string      `yaml:",omitempty"`
+		Summary    bool        `yaml:",omitempty"`
+		Pinned     bool        `yaml:",omitempty"`
+		Tags       []string    `yaml:",omitempty"`
+		Attachment *Attachment `yaml:",omitempty"`
+		// Redactions counts the secrets replaced with placeholders by kind.
+		Redactions map[string]int `yaml:",omitempty"`
+	}
+
+	// Attachment - Describes the file a message was created from. Source, ModTime and Hash record the file
+	// when it was attached, so that changes can be detected later. Hash is the SHA-256 of the whole file.
+	Attachment struct {
+		// Path is the path of the file, or the command the contents came from for other kinds.
+		Path    string
+		Kind    string    `yaml:",omitempty"`
+		Source  string    `yaml:",omitempty"`
+		ModTime time.Time `yaml:",omitempty"`
+		Hash    string    `yaml:",omitempty"`
+		// Symbol, StartLine and EndLine are set when only a part of the file is attached.
+		Symbol    string `yaml:",omitempty"`
+		StartLine int    `yaml:",omitempty"`
+		EndLine   int    `yaml:",omitempty"`
+	}
+
+	// AttachmentUpdate - New contents of the file attached by the message Sha1.
+	AttachmentUpdate struct {
+		Sha1       string
+		Attachment Attachment
+		Contents   string
 	}
 )
 
@@ -58,6 +121,12 @@ const (
 	ChatRoleAssistant = "assistant"
 )
 
+// Kinds of attachments other than files.
+const (
+	AttachmentKindGitDiff = "git-diff"
+	AttachmentKindRepoMap = "repo-map"
+)
+
 func (c conv) GetMessages() []Message {
 	return c.Messages
 }
@@ -77,7 +146,90 @@ func (c conv) GetSystem() string {
 	return c.System
 }
 
+// ChangeSystem sets the system prompt of the messages appended from now on. The previous versions are kept,
+// and moving HEAD to another branch restores the system prompt of that branch.
+func (c *conv) ChangeSystem(text string) SystemPrompt {
+	if len(c.Systems) == 0 {
+		c.addSystem(c.System)
+	}
+	c.System = text
+	return c.addSystem(text)
+}
+
+func (c conv) GetSystems() []SystemPrompt {
+	return c.Systems
+}
+
+// SystemOf returns the system prompt the message was sent with.
+func (c conv) SystemOf(m Message) string {
+	if m.System == "" && len(c.Systems) > 0 {
+		return c.Systems[0].Content
+	}
+	for _, s := range c.Systems {
+		if s.Sha1 == m.System {
+			return s.Content
+		}
+	}
+	return c.System
+}
+
+func (c *conv) addSystem(text string) SystemPrompt {
+	sha := CalculateSHA1([]string{text})
+	for _, s := range c.Systems {
+		if s.Sha1 == sha {
+			return s
+		}
+	}
+
+	s := SystemPrompt{Sha1: sha, Content: text, CreatedAt: time.Now()}
+	c.Systems = append(c.Systems, s)
+	return s
+}
+
+// currentSystem returns the version of the current system prompt to record in new messages.
+func (c *conv) currentSystem() string {
+	if len(c.Systems) == 0 {
+		return ""
+	}
+	s := c.addSystem(c.System)
+	if s.Sha1 == c.Systems[0].Sha1 {
+		return ""
+	}
+	return s.Sha1
+}
+
+// messageSha1 includes the system prompt version when it differs from the one of the parent, so that the same
+// message sent under another system prompt is a different message. Other messages keep the SHA1 they always had.
+func (c conv) messageSha1(role string, content string, parent string, system string) string {
+	parts := []string{role, content, parent}
+	parentSystem := ""
+	for _, m := range c.Messages {
+		if m.Sha1 == parent {
+			parentSystem = m.System
+			break
+		}
+	}
+	if system != parentSystem {
+		parts = append(parts, system)
+	}
+	return CalculateSHA1(parts)
+}
+
 func (c *conv) Modify(m Message) error {
+	if m.Role == ChatRoleUser {
+		content, redactions, err := c.redact(m.Content)
+		if err != nil {
+			return err
+		}
+		m.Content = content
+		for name, count := range redactions {
+			if m.Redactions == nil {
+				m.Redactions = map[string]int{}
+			}
+			m.Redactions[name] += count
+		}
+	}
+
 	for i, message := range c.Messages {
 		if message.Sha1 == m.Sha1 {
 			c.Messages[i] = m
@@ -88,31 +240,47 @@ func (c *conv) Modify(m Message) error {
 	return fmt.Errorf("no message found with provided sha1: %s", m.Sha1)
 }
 
-func (c *conv) Append(role string, message string) Message {
+func (c *conv) Append(role string, message string) (Message, error) {
+	var redactions map[string]int
+	if role == ChatRoleUser {
+		var err error
+		message, redactions, err = c.redact(message)
+		if err != nil {
+			return Message{}, err
+		}
+	}
+
 	parent := "ROOT"
-	for i, m := range c.Messages {
+	for _, m := range c.Messages {
 		if m.Head {
 			parent = m.Sha1
 		}
-		c.Messages[i].Head = false
 	}
 
-	sha := CalculateSHA1([]string{role, message, parent})
+	system := c.currentSystem()
+	sha := c.messageSha1(role, message, parent, system)
 
 	if c.Profile.DiceRoll != "" {
 		result, err := util.RollDice(c.Profile.DiceRoll)
 		if err != nil {
-			panic(err) // profile validation should have caught this
+			return Message{}, fmt.Errorf("%w: DiceRoll: %v", config.ErrInvalidConfig, err)
 		}
 		message = fmt.Sprintf("%s\n DiceRoll %s: %d", message, c.Profile.DiceRoll, result)
 	}
 
+	for i := range c.Messages {
+		c.Messages[i].Head = false
+	}
+
 	msg := Message{
 		Sha1:       sha,
 		ParentSha1: parent,
 		Role:       role,
 		Content:    message,
 		Head:       true,
+		CreatedAt:  time.Now(),
+		System:     system,
+		Redactions: redactions,
 	}
 
 	if role == ChatRoleUser {
@@ -121,6 +289,182 @@ func (c *conv) Append(role string, message string) Message {
 
 	c.Messages = append(c.Messages, msg)
 
+	return msg, nil
+}
+
+// redact replaces secrets in user content by the redaction settings of the profile.
+func (c *conv) redact(content string) (string, map[string]int, error) {
+	redactor, err := redact.New(c.Profile.Redaction)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: Redaction: %v", config.ErrInvalidConfig, err)
+	}
+	content, redactions := redactor.Redact(content)
+	return content, redactions, nil
+}
+
+// AppendAttachment appends the contents of a file as a user message.
+func (c *conv) AppendAttachment(attachment Attachment, contents string) (Message, error) {
+	if _, err := c.Append(ChatRoleUser, attachmentContent(attachment, contents)); err != nil {
+		return Message{}, err
+	}
+
+	last := &c.Messages[len(c.Messages)-1]
+	last.Attachment = &attachment
+	return *last, nil
+}
+
+// ReplaceAttachments copies the HEAD chain with the attachments replaced by their new contents, starting from
+// the first updated attachment. The original chain stays available as a side branch.
+func (c *conv) ReplaceAttachments(updates []AttachmentUpdate) (Message, error) {
+	bySha := map[string]AttachmentUpdate{}
+	for _, u := range updates {
+		bySha[u.Sha1] = u
+	}
+
+	chain := c.MessagesFromHead()
+	index := -1
+	for i, message := range chain {
+		if _, ok := bySha[message.Sha1]; ok {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return Message{}, fmt.Errorf("no attachment to replace in the current branch")
+	}
+
+	var messages []Message
+	for _, message := range chain[index:] {
+		if u, ok := bySha[message.Sha1]; ok {
+			attachment := u.Attachment
+			content, redactions, err := c.redact(attachmentContent(attachment, u.Contents))
+			if err != nil {
+				return Message{}, err
+			}
+			message.Content, message.Redactions = content, redactions
+			message.Attachment = &attachment
+			message.CreatedAt = time.Now()
+		}
+		messages = append(messages, message)
+	}
+
+	return c.copyChain(chain[index].ParentSha1, messages), nil
+}
+
+// Detach copies the HEAD chain without the attachment message. The original chain stays available as a side branch.
+func (c *conv) Detach(sha1partial string) (Message, error) {
+	chain := c.MessagesFromHead()
+	for i, message := range chain {
+		if !strings.HasPrefix(message.Sha1, sha1partial) {
+			continue
+		}
+		if message.Attachment == nil {
+			return Message{}, fmt.Errorf("[%.6s] is not an attachment", message.Sha1)
+		}
+
+		if i == len(chain)-1 {
+			return c.ChangeHead(message.ParentSha1)
+		}
+		return c.copyChain(message.ParentSha1, chain[i+1:]), nil
+	}
+	return Message{}, fmt.Errorf("no message in the current branch with provided sha1partial: %s", sha1partial)
+}
+
+// copyChain appends copies of the messages onto the parent as a new branch and makes the last one HEAD.
+// Copies identical to an existing message are not duplicated.
+func (c *conv) copyChain(parent string, messages []Message) Message {
+	var head Message
+	for _, message := range messages {
+		message.ParentSha1 = parent
+		message.Sha1 = c.messageSha1(message.Role, message.Content, parent, message.System)
+
+		if existing, err := c.ChangeHead(message.Sha1); err == nil && existing.Sha1 == message.Sha1 {
+			head = existing
+		} else {
+			head = c.appendMessage(message)
+		}
+		parent = head.Sha1
+	}
+	return head
+}
+
+// AttachmentContents returns the file contents of an attachment message.
+func AttachmentContents(m Message) string {
+	if m.Attachment == nil {
+		return m.Content
+	}
+
+	prefix := attachmentContent(*m.Attachment, "")
+	content, ok := strings.CutPrefix(m.Content, strings.TrimSuffix(prefix, "```"))
+	if !ok {
+		return m.Content
+	}
+	return strings.TrimSuffix(content, "```")
+}
+
+func attachmentContent(attachment Attachment, contents string) string {
+	switch attachment.Kind {
+	case AttachmentKindGitDiff:
+		return fmt.Sprintf("Output of `%s`:\n ```diff\n%s```", attachment.Path, contents)
+	case AttachmentKindRepoMap:
+		return fmt.Sprintf("Files in the repository, from `%s`:\n ```\n%s```", attachment.Path, contents)
+	}
+
+	header := fmt.Sprintf("Path: `%s`", attachment.Path)
+	switch {
+	case attachment.Symbol != "":
+		header += fmt.Sprintf(" (%s, lines %d-%d)", attachment.Symbol, attachment.StartLine, attachment.EndLine)
+	case attachment.StartLine != 0:
+		header += fmt.Sprintf(" (lines %d-%d)", attachment.StartLine, attachment.EndLine)
+	}
+	return fmt.Sprintf("%s\n ```\n%s```", header, contents)
+}
+
+// Compact replaces the part of the HEAD chain before keepFrom with a single summary message.
+// The kept messages are copied onto the summary, so the original chain stays available as a side branch.
+func (c *conv) Compact(summary string, keepFrom string) (Message, error) {
+	chain := c.MessagesFromHead()
+
+	index := -1
+	for i, message := range chain {
+		if message.Sha1 == keepFrom {
+			index = i
+			break
+		}
+	}
+
+	if index < 1 {
+		return Message{}, fmt.Errorf("no message to compact before: %.6s", keepFrom)
+	}
+
+	system := c.currentSystem()
+	parent := c.appendMessage(Message{
+		Sha1:       c.messageSha1(ChatRoleUser, summary, "ROOT", system),
+		ParentSha1: "ROOT",
+		Role:       ChatRoleUser,
+		Content:    summary,
+		CreatedAt:  time.Now(),
+		Summary:    true,
+		System:     system,
+	})
+
+	for _, message := range chain[index:] {
+		message.ParentSha1 = parent.Sha1
+		message.Sha1 = c.messageSha1(message.Role, message.Content, parent.Sha1, message.System)
+		parent = c.appendMessage(message)
+	}
+
+	return parent, nil
+}
+
+// appendMessage adds the message as the new HEAD as is.
+func (c *conv) appendMessage(msg Message) Message {
+	for i := range c.Messages {
+		c.Messages[i].Head = false
+	}
+
+	msg.Head = true
+	c.Messages = append(c.Messages, msg)
 	return msg
 }
 
@@ -134,7 +478,7 @@ func (c *conv) GetRootMessage() (Message, error) {
 
 }
 
-func (c *conv) GetMessageFromSha1(sha1partial string) (Message, error) {
+func (c conv) GetMessageFromSha1(sha1partial string) (Message, error) {
 	for _, message := range c.Messages {
 		if strings.HasPrefix(message.Sha1, sha1partial) {
 			return message, nil
@@ -166,54 +510,143 @@ func (c *conv) ChangeHead(sha1Partial string) (Message, error) {
 		for i := range c.Messages {
 			c.Messages[i].Head = i == foundMessageIndex
 		}
+		c.System = c.SystemOf(c.Messages[foundMessageIndex])
 		return c.Messages[foundMessageIndex], nil
 	}
 	return Message{}, fmt.Errorf("no message found with provided sha1Partial: %s", sha1Partial)
 }
 
 func (c conv) MessagesFromHead() []Message {
-	foundHead := false
-	currentHead := ""
-	for !foundHead {
-		for _, message := range c.Messages {
-			if message.Head {
-				foundHead = true
-				currentHead = message.Sha1
-				break
-			}
+	for _, message := range c.Messages {
+		if message.Head {
+			return c.chainTo(message.Sha1)
 		}
+	}
 
-		if !foundHead {
-			break
-		}
+	return []Message{}
+}
 
-		messageChain := []Message{}
-		for currentHead != "" {
-			for i, message := range c.Messages {
-				if message.Sha1 == currentHead {
-					currentHead = message.ParentSha1
-					messageChain = append(messageChain, message)
-					break
-				} else if i == len(c.Messages)-1 {
-					currentHead = ""
-				}
+// MessagesTo returns the chain from the root to the message matching the SHA1 prefix.
+func (c conv) MessagesTo(sha1partial string) ([]Message, error) {
+	msg, err := c.GetMessageFromSha1(sha1partial)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.chainTo(msg.Sha1), nil
+}
+
+func (c conv) chainTo(sha1 string) []Message {
+	bySha := map[string]Message{}
+	for _, message := range c.Messages {
+		bySha[message.Sha1] = message
+	}
+
+	messageChain := []Message{}
+	for current, ok := bySha[sha1]; ok; current, ok = bySha[current.ParentSha1] {
+		messageChain = append(messageChain, current)
+	}
+
+	for i, j := 0, len(messageChain)-1; i < j; i, j = i+1, j-1 {
+		messageChain[i], messageChain[j] = messageChain[j], messageChain[i]
+	}
+
+	return messageChain
+}
+
+// RequestMessages returns the messages of the HEAD chain to be sent, and the ones excluded by the context strategy of the profile.
+// Pinned messages are always sent with the rest of their turn. The ones on other branches are sent first in a user message.
+func (c conv) RequestMessages() ([]Message, []Message) {
+	chain := c.MessagesFromHead()
+	pinned := c.pinnedOutsideChain(chain)
+
+	budget := c.Profile.GetRequestBudget() - token.EstimateMessage(c.System) - EstimateTokens(pinned)
+	strategy, err := NewStrategy(c.Profile.ContextStrategy, budget)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("invalid context strategy, sending all messages: %v", err))
+		return withPinned(pinned, chain), nil
+	}
+
+	kept, excluded := strategy.Apply(chain)
+	if len(excluded) == 0 {
+		return withPinned(pinned, kept), excluded
+	}
+
+	isKept := map[string]bool{}
+	for _, message := range kept {
+		isKept[message.Sha1] = true
+	}
+
+	// Keeping only the pinned message of a dropped turn could send two replies in a row.
+	kept = []Message{}
+	var rest []Message
+	for _, turn := range splitTurns(chain) {
+		pinnedTurn := false
+		for _, message := range turn {
+			pinnedTurn = pinnedTurn || message.Pinned
+		}
+		for _, message := range turn {
+			if pinnedTurn || isKept[message.Sha1] {
+				kept = append(kept, message)
+			} else {
+				rest = append(rest, message)
 			}
 		}
+	}
 
-		for i, j := 0, len(messageChain)-1; i < j; i, j = i+1, j-1 {
-			messageChain[i], messageChain[j] = messageChain[j], messageChain[i]
-		}
+	return withPinned(pinned, kept), rest
+}
 
-		return messageChain
+// withPinned puts the pinned messages from other branches in front of the request. They are merged into the first
+// message when it is a user message, so that two user messages do not follow each other.
+func withPinned(pinned []Message, kept []Message) []Message {
+	if len(pinned) == 0 {
+		return kept
 	}
 
-	return []Message{}
+	var notes []string
+	for _, message := range pinned {
+		notes = append(notes, message.Content)
+	}
+	note := pinned[0]
+	note.Content = strings.Join(notes, "\n\n")
+
+	if len(kept) > 0 && kept[0].Role == ChatRoleUser {
+		first := kept[0]
+		first.Content = note.Content + "\n\n" + first.Content
+		return append([]Message{first}, kept[1:]...)
+	}
+	return append([]Message{note}, kept...)
+}
+
+// pinnedOutsideChain returns the pinned messages that are not in the chain, rewritten as user messages.
+// Copies of a message in the chain, such as the ones made by Compact, are skipped.
+func (c conv) pinnedOutsideChain(chain []Message) []Message {
+	inChain := map[string]bool{}
+	for _, message := range chain {
+		inChain[message.Role+"\x00"+message.Content] = true
+	}
+
+	var pinned []Message
+	for _, message := range c.Messages {
+		key := message.Role + "\x00" + message.Content
+		if !message.Pinned || inChain[key] {
+			continue
+		}
+		inChain[key] = true
+
+		message.Content = fmt.Sprintf("Pinned message [%.6s] (%s) from another branch:\n\n%s", message.Sha1, message.Role, message.Content)
+		message.Role = ChatRoleUser
+		pinned = append(pinned, message)
+	}
+	return pinned
 }
 
 func (c conv) ToOpenAIMessage() []openai.ChatCompletionMessage {
 	var chatMessages []openai.ChatCompletionMessage
 
-	for _, message := range c.MessagesFromHead() {
+	kept, _ := c.RequestMessages()
+	for _, message := range kept {
 		chatMessages = append(chatMessages, openai.ChatCompletionMessage{
 			Role:    message.Role,
 			Content: message.Content,
@@ -227,11 +660,12 @@ func (c conv) ToOpenAIMessage() []openai.ChatCompletionMessage {
 	return chatMessages
 }
 
-func (c conv) ToAnthropicMessage() []anthropic.Message {
+func (c conv) ToAnthropicMessage() ([]anthropic.Message, error) {
 	var chatMessages []anthropic.Message
 
 	// NOTE: Anthropic does not include system messages in the conversation
-	for _, message := range c.MessagesFromHead() {
+	kept, _ := c.RequestMessages()
+	for _, message := range kept {
 		var role string
 
 		if message.Role == ChatRoleUser {
@@ -239,7 +673,7 @@ func (c conv) ToAnthropicMessage() []anthropic.Message {
 		} else if message.Role == ChatRoleAssistant {
 			role = anthropic.ChatMessageRoleAssistant
 		} else {
-			panic(fmt.Sprintf("unknown role: %s", message.Role))
+			return nil, fmt.Errorf("message [%.6s] has a role Anthropic does not accept: %s", message.Sha1, message.Role)
 		}
 		chatMessages = append(chatMessages, anthropic.Message{
 			Role:    role,
@@ -251,7 +685,7 @@ func (c conv) ToAnthropicMessage() []anthropic.Message {
 		slog.Debug(fmt.Sprintf("[%s]: %.32s", message.Role, message.Content))
 	}
 
-	return chatMessages
+	return chatMessages, nil
 }
 
 func (c conv) ToYAML() ([]byte, error) {
@@ -282,10 +716,64 @@ func (c conv) convertSystemToMessage() Message {
 	}
 }
 
+// Label returns the path with the attached part, such as main.go:10-80 or main.go#main.
+func (a Attachment) Label() string {
+	switch {
+	case a.Symbol != "":
+		return a.Path + "#" + a.Symbol
+	case a.StartLine != 0:
+		return fmt.Sprintf("%s:%d-%d", a.Path, a.StartLine, a.EndLine)
+	}
+	return a.Path
+}
+
+// SourcePath returns the path to read the attached file from. Attachments saved before Source was recorded
+// only have the path as it was given.
+func (a Attachment) SourcePath() string {
+	if a.Source != "" {
+		return a.Source
+	}
+	return a.Path
+}
+
+// Key identifies the attached part of a file, ignoring the lines a symbol was found at.
+func (a Attachment) Key() string {
+	source := a.SourcePath()
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	if a.Symbol != "" {
+		return source + "#" + a.Symbol
+	}
+	return source + strings.TrimPrefix(a.Label(), a.Path)
+}
+
+// HasTag reports whether the message is tagged with the tag.
+func (m Message) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (c conv) GetFilename() string {
 	return c.Filename
 }
 
+func (c conv) GetTitle() string {
+	return c.Title
+}
+
+func (c *conv) SetTitle(title string) {
+	c.Title = title
+}
+
+func (c conv) GetSource() string {
+	return c.Source
+}
+
 func (c conv) Print() {
 	yellow := color.New(color.FgHiYellow).SprintFunc()
 	blue := color.New(color.FgHiBlue).SprintFunc()
@@ -309,12 +797,34 @@ func (c conv) Print() {
 		}
 	}
 
+	systemOf := map[string]string{}
+	for _, msg := range c.GetMessages() {
+		systemOf[msg.Sha1] = msg.System
+	}
+
 	for _, msg := range c.GetMessages() {
-		head := ""
+		var labels []string
 		if msg.Head {
-			head = "Head"
+			labels = append(labels, "Head")
+		}
+		if msg.System != systemOf[msg.ParentSha1] {
+			labels = append(labels, fmt.Sprintf("System %.6s", CalculateSHA1([]string{c.SystemOf(msg)})))
+		}
+		if msg.Summary {
+			labels = append(labels, "Summary")
+		}
+		if msg.Pinned {
+			labels = append(labels, "Pinned")
+		}
+		for _, tag := range msg.Tags {
+			labels = append(labels, "#"+tag)
 		}
-		fmt.Printf("%s %s\n", yellow(fmt.Sprintf("[%.*s] %s -> [%.*s]", 6, msg.Sha1, msg.Role, 6, msg.ParentSha1)), blue(head))
+		head := strings.Join(labels, " ")
+		role := msg.Role
+		if msg.Model != "" {
+			role = fmt.Sprintf("%s (%s)", msg.Role, msg.Model)
+		}
+		fmt.Printf("%s %s\n", yellow(fmt.Sprintf("[%.*s] %s -> [%.*s]", 6, msg.Sha1, role, 6, msg.ParentSha1)), blue(head))
 
 		out, err := r.Render(msg.Content)
 		if err != nil {
@@ -337,6 +847,18 @@ func NewConversation(profile config.Profile) Conversation {
 	}
 }
 
+// FromMessages creates a conversation from existing messages, such as the ones of an imported history.
+// The message marked as Head becomes HEAD.
+func FromMessages(profile config.Profile, system string, title string, source string, messages []Message) Conversation {
+	return &conv{
+		Title:    title,
+		Source:   source,
+		Profile:  profile,
+		System:   system,
+		Messages: messages,
+	}
+}
+
 func FromYAML(yamlBytes []byte, filename string) (Conversation, error) {
 	var c conv
 	err := yaml.Unmarshal(yamlBytes, &c)
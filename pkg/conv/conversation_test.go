@@ -0,0 +1,153 @@
+package conv
+
+import (
+	"errors"
+	"github.com/kznrluk/aski/pkg/config"
+	"strings"
+	"testing"
+)
+
+func TestReplaceAttachments(t *testing.T) {
+	cv := NewConversation(config.InitialProfile())
+
+	file, _ := cv.AppendAttachment(Attachment{Path: "a.go", Hash: "old"}, "package a\n")
+	cv.Append(ChatRoleUser, "review this")
+	answer, _ := cv.Append(ChatRoleAssistant, "looks good")
+
+	if got := AttachmentContents(file); got != "package a\n" {
+		t.Errorf("Expected the file contents back, but got %q", got)
+	}
+
+	head, err := cv.ReplaceAttachments([]AttachmentUpdate{{Sha1: file.Sha1, Attachment: Attachment{Path: "a.go", Hash: "new"}, Contents: "package b\n"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	chain := cv.MessagesFromHead()
+	if len(chain) != 3 || chain[2].Sha1 != head.Sha1 || head.Content != answer.Content {
+		t.Fatalf("Expected a copy of the branch ending with the answer, but got %v", shas(chain))
+	}
+	if AttachmentContents(chain[0]) != "package b\n" || chain[0].Attachment.Hash != "new" || chain[0].ParentSha1 != "ROOT" {
+		t.Errorf("Expected the new attachment at the root, but got %+v", chain[0])
+	}
+	if chain[1].ParentSha1 != chain[0].Sha1 || head.ParentSha1 != chain[1].Sha1 {
+		t.Errorf("Expected the copied messages to be chained, but got %+v", chain)
+	}
+
+	if old, err := cv.MessagesTo(answer.Sha1); err != nil || len(old) != 3 || old[0].Sha1 != file.Sha1 {
+		t.Errorf("Expected the original branch to be kept")
+	}
+
+	if _, err := cv.ReplaceAttachments([]AttachmentUpdate{{Sha1: "missing"}}); err == nil {
+		t.Errorf("Expected an error when no attachment is in the branch")
+	}
+}
+
+func TestAttachmentHeaderShowsRange(t *testing.T) {
+	cv := NewConversation(config.InitialProfile())
+
+	msg, _ := cv.AppendAttachment(Attachment{Path: "a.go", Symbol: "Config.Validate", StartLine: 10, EndLine: 16}, "func (c *Config) Validate() error {}\n")
+	if !strings.HasPrefix(msg.Content, "Path: `a.go` (Config.Validate, lines 10-16)\n") {
+		t.Errorf("Expected the symbol and lines in the header, but got %q", msg.Content)
+	}
+	if got := AttachmentContents(msg); got != "func (c *Config) Validate() error {}\n" {
+		t.Errorf("Expected the file contents back, but got %q", got)
+	}
+	if label := msg.Attachment.Label(); label != "a.go#Config.Validate" {
+		t.Errorf("Unexpected label: %s", label)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	cv := NewConversation(config.InitialProfile())
+
+	a, _ := cv.AppendAttachment(Attachment{Path: "a.go"}, "package a\n")
+	b, _ := cv.AppendAttachment(Attachment{Path: "b.go"}, "package b\n")
+	question, _ := cv.Append(ChatRoleUser, "review this")
+
+	head, err := cv.Detach(b.Sha1[:6])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	chain := cv.MessagesFromHead()
+	if len(chain) != 2 || chain[0].Sha1 != a.Sha1 || chain[1].Sha1 != head.Sha1 || head.ParentSha1 != a.Sha1 {
+		t.Fatalf("Expected the question right after a.go, but got %v", shas(chain))
+	}
+	if head.Content != question.Content {
+		t.Errorf("Expected the question to be copied, but got %q", head.Content)
+	}
+	if old, err := cv.MessagesTo(question.Sha1); err != nil || len(old) != 3 {
+		t.Errorf("Expected the original branch to be kept")
+	}
+
+	if head, err := cv.Detach(a.Sha1); err != nil || cv.Last().Sha1 != head.Sha1 || head.ParentSha1 != "ROOT" {
+		t.Errorf("Expected the question at the root, but got %+v, %v", head, err)
+	}
+	if _, err := cv.Detach(cv.Last().Sha1); err == nil {
+		t.Errorf("Expected an error when the message is not an attachment")
+	}
+}
+
+func TestAppendInvalidProfile(t *testing.T) {
+	profile := config.InitialProfile()
+	profile.DiceRoll = "1dx"
+	cv := NewConversation(profile)
+
+	if _, err := cv.Append(ChatRoleUser, "roll"); !errors.Is(err, config.ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, but got %v", err)
+	}
+	if len(cv.GetMessages()) != 0 || cv.Last().Role != "system" {
+		t.Errorf("Expected nothing to be appended, but got %+v", cv.GetMessages())
+	}
+}
+
+func TestAppendLeavesModel(t *testing.T) {
+	cv := NewConversation(config.InitialProfile())
+
+	// Assistant messages appended from a profile or an edit were not produced by the current model.
+	answer, _ := cv.Append(ChatRoleAssistant, "hi")
+	if answer.Model != "" || answer.Profile != "" {
+		t.Errorf("Expected no model on an appended message, but got %+v", answer)
+	}
+}
+
+func TestChangeSystem(t *testing.T) {
+	cv := NewConversation(config.InitialProfile())
+	cv.SetSystem("Answer in English.")
+	question, _ := cv.Append(ChatRoleUser, "hello")
+	answer, _ := cv.Append(ChatRoleAssistant, "hi")
+
+	if question.Sha1 != CalculateSHA1([]string{ChatRoleUser, "hello", "ROOT"}) || question.System != "" {
+		t.Errorf("Expected messages without a change to be as before, but got %+v", question)
+	}
+
+	system := cv.ChangeSystem("Answer in French.")
+	if cv.GetSystem() != "Answer in French." || len(cv.GetSystems()) != 2 || cv.GetSystems()[0].Content != "Answer in English." {
+		t.Fatalf("Expected the original and the new version, but got %+v", cv.GetSystems())
+	}
+
+	_, _ = cv.ChangeHead("ROOT")
+	french, _ := cv.Append(ChatRoleUser, "hello")
+	if french.Sha1 == question.Sha1 || french.System != system.Sha1 {
+		t.Errorf("Expected the same message under another system prompt to be a new message, but got %+v", french)
+	}
+	if cv.SystemOf(french) != "Answer in French." || cv.SystemOf(answer) != "Answer in English." {
+		t.Errorf("Expected each branch to keep its system prompt")
+	}
+
+	_, _ = cv.ChangeHead(answer.Sha1)
+	if cv.GetSystem() != "Answer in English." {
+		t.Errorf("Expected moving HEAD to restore the system prompt of the branch, but got %q", cv.GetSystem())
+	}
+	next, _ := cv.Append(ChatRoleUser, "thanks")
+	if next.System != "" {
+		t.Errorf("Expected the branch to continue with the original system prompt, but got %s", next.System)
+	}
+
+	_, _ = cv.ChangeHead(french.Sha1)
+	reply, _ := cv.Append(ChatRoleAssistant, "salut")
+	if reply.System != system.Sha1 || reply.Sha1 != CalculateSHA1([]string{ChatRoleAssistant, "salut", french.Sha1}) {
+		t.Errorf("Expected the reply to continue the French branch, but got %+v", reply)
+	}
+}
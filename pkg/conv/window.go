@@ -0,0 +1,153 @@
+package conv
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/token"
+)
+
+// Strategy decides which messages of the HEAD chain are sent to the API.
+// It is applied to the request of every vendor.
+type Strategy interface {
+	Apply(chain []Message) (kept []Message, excluded []Message)
+}
+
+type (
+	keepAll         struct{}
+	lastTurns       struct{ last int }
+	firstLastTurns  struct{ first, last int }
+	dropAttachments struct{ budget int }
+	tokenBudget     struct {
+		first  int
+		budget int
+	}
+)
+
+// NewStrategy returns the strategy described in the profile.
+// budget is used when the profile does not specify TokenBudget.
+func NewStrategy(s config.ContextStrategy, budget int) (Strategy, error) {
+	if s.TokenBudget > 0 {
+		budget = s.TokenBudget
+	}
+
+	switch s.Type {
+	case config.ContextStrategyAll:
+		return keepAll{}, nil
+	case config.ContextStrategyLast:
+		return lastTurns{last: s.KeepLast}, nil
+	case config.ContextStrategyFirstLast:
+		return firstLastTurns{first: s.KeepFirst, last: s.KeepLast}, nil
+	case config.ContextStrategyDropAttachments:
+		return dropAttachments{budget: budget}, nil
+	case config.ContextStrategyBudget:
+		return tokenBudget{first: s.KeepFirst, budget: budget}, nil
+	default:
+		return nil, fmt.Errorf("unknown context strategy: %s", s.Type)
+	}
+}
+
+// EstimateTokens returns the estimated number of tokens of the messages.
+func EstimateTokens(messages []Message) int {
+	total := 0
+	for _, message := range messages {
+		total += token.EstimateMessage(message.Content)
+	}
+	return total
+}
+
+func (keepAll) Apply(chain []Message) ([]Message, []Message) {
+	return chain, nil
+}
+
+func (s lastTurns) Apply(chain []Message) ([]Message, []Message) {
+	turns := splitTurns(chain)
+	keep := make([]bool, len(turns))
+	for i := len(turns) - s.last; i < len(turns); i++ {
+		if i >= 0 {
+			keep[i] = true
+		}
+	}
+	return selectTurns(turns, keep)
+}
+
+func (s firstLastTurns) Apply(chain []Message) ([]Message, []Message) {
+	turns := splitTurns(chain)
+	keep := make([]bool, len(turns))
+	for i := range turns {
+		keep[i] = i < s.first || i >= len(turns)-s.last
+	}
+	return selectTurns(turns, keep)
+}
+
+func (s dropAttachments) Apply(chain []Message) ([]Message, []Message) {
+	kept := append([]Message{}, chain...)
+	var excluded []Message
+
+	for i := 0; i < len(kept) && EstimateTokens(kept) > s.budget; {
+		if kept[i].Attachment != nil {
+			excluded = append(excluded, kept[i])
+			kept = append(kept[:i], kept[i+1:]...)
+			continue
+		}
+		i++
+	}
+
+	if EstimateTokens(kept) <= s.budget {
+		return kept, excluded
+	}
+
+	// Attachments alone were not enough, fall back to dropping the oldest turns.
+	k, e := tokenBudget{budget: s.budget}.Apply(kept)
+	return k, append(excluded, e...)
+}
+
+func (s tokenBudget) Apply(chain []Message) ([]Message, []Message) {
+	turns := splitTurns(chain)
+	keep := make([]bool, len(turns))
+
+	used := 0
+	for i := 0; i < s.first && i < len(turns); i++ {
+		keep[i] = true
+		used += EstimateTokens(turns[i])
+	}
+
+	// The latest turn is always sent, even if it does not fit.
+	for i := len(turns) - 1; i >= 0; i-- {
+		if keep[i] {
+			continue
+		}
+		size := EstimateTokens(turns[i])
+		if used+size > s.budget && i != len(turns)-1 {
+			break
+		}
+		keep[i] = true
+		used += size
+	}
+
+	return selectTurns(turns, keep)
+}
+
+// splitTurns groups the chain into turns. A turn starts at a user message that follows a non-user message,
+// so consecutive user messages such as file attachments belong to the same turn.
+func splitTurns(chain []Message) [][]Message {
+	var turns [][]Message
+	for i, message := range chain {
+		if i == 0 || (message.Role == ChatRoleUser && chain[i-1].Role != ChatRoleUser) {
+			turns = append(turns, []Message{})
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], message)
+	}
+	return turns
+}
+
+func selectTurns(turns [][]Message, keep []bool) ([]Message, []Message) {
+	var kept, excluded []Message
+	for i, turn := range turns {
+		if keep[i] {
+			kept = append(kept, turn...)
+		} else {
+			excluded = append(excluded, turn...)
+		}
+	}
+	return kept, excluded
+}
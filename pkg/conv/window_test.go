@@ -0,0 +1,156 @@
+package conv
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testChain() []Message {
+	return []Message{
+		{Sha1: "a1", Role: ChatRoleUser, Content: "file", Attachment: &Attachment{Path: "a.go"}},
+		{Sha1: "u1", Role: ChatRoleUser, Content: "first question"},
+		{Sha1: "r1", Role: ChatRoleAssistant, Content: "first answer"},
+		{Sha1: "u2", Role: ChatRoleUser, Content: "second question"},
+		{Sha1: "r2", Role: ChatRoleAssistant, Content: "second answer"},
+		{Sha1: "u3", Role: ChatRoleUser, Content: "third question"},
+	}
+}
+
+func shas(messages []Message) []string {
+	result := []string{}
+	for _, m := range messages {
+		result = append(result, m.Sha1)
+	}
+	return result
+}
+
+func TestStrategies(t *testing.T) {
+	testCases := []struct {
+		name     string
+		strategy config.ContextStrategy
+		budget   int
+		kept     []string
+		excluded []string
+	}{
+		{
+			name:     "Keep all",
+			strategy: config.ContextStrategy{},
+			kept:     []string{"a1", "u1", "r1", "u2", "r2", "u3"},
+			excluded: []string{},
+		},
+		{
+			name:     "Last turns",
+			strategy: config.ContextStrategy{Type: config.ContextStrategyLast, KeepLast: 2},
+			kept:     []string{"u2", "r2", "u3"},
+			excluded: []string{"a1", "u1", "r1"},
+		},
+		{
+			name:     "First and last turns",
+			strategy: config.ContextStrategy{Type: config.ContextStrategyFirstLast, KeepFirst: 1, KeepLast: 1},
+			kept:     []string{"a1", "u1", "r1", "u3"},
+			excluded: []string{"u2", "r2"},
+		},
+		{
+			name:     "Drop attachments",
+			strategy: config.ContextStrategy{Type: config.ContextStrategyDropAttachments},
+			budget:   EstimateTokens(testChain()) - 1,
+			kept:     []string{"u1", "r1", "u2", "r2", "u3"},
+			excluded: []string{"a1"},
+		},
+		{
+			name:     "Token budget keeps the first turn",
+			strategy: config.ContextStrategy{Type: config.ContextStrategyBudget, KeepFirst: 1},
+			budget:   EstimateTokens(testChain()[:3]) + EstimateTokens(testChain()[5:]),
+			kept:     []string{"a1", "u1", "r1", "u3"},
+			excluded: []string{"u2", "r2"},
+		},
+		{
+			name:     "Token budget always sends the latest turn",
+			strategy: config.ContextStrategy{Type: config.ContextStrategyBudget},
+			budget:   1,
+			kept:     []string{"u3"},
+			excluded: []string{"a1", "u1", "r1", "u2", "r2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			strategy, err := NewStrategy(tc.strategy, tc.budget)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			kept, excluded := strategy.Apply(testChain())
+			if !reflect.DeepEqual(shas(kept), tc.kept) {
+				t.Errorf("Expected kept %v, but got %v", tc.kept, shas(kept))
+			}
+			if !reflect.DeepEqual(shas(excluded), tc.excluded) {
+				t.Errorf("Expected excluded %v, but got %v", tc.excluded, shas(excluded))
+			}
+		})
+	}
+}
+
+func TestSplitTurnsGroupsConsecutiveUserMessages(t *testing.T) {
+	turns := splitTurns(testChain())
+	if len(turns) != 3 {
+		t.Fatalf("Expected 3 turns, but got %d", len(turns))
+	}
+	if got := strings.Join(shas(turns[0]), ","); got != "a1,u1,r1" {
+		t.Errorf("Expected first turn a1,u1,r1, but got %s", got)
+	}
+}
+
+func TestRequestMessagesKeepsPinned(t *testing.T) {
+	profile := config.InitialProfile()
+	profile.ContextStrategy = config.ContextStrategy{Type: config.ContextStrategyLast, KeepLast: 1}
+	cv := NewConversation(profile)
+
+	file, _ := cv.AppendAttachment(Attachment{Path: "a.go"}, "package a\n")
+	file.Pinned = true
+	_ = cv.Modify(file)
+	cv.Append(ChatRoleAssistant, "ok")
+	side, _ := cv.Append(ChatRoleUser, "side question")
+	side.Pinned = true
+	_ = cv.Modify(side)
+
+	_, _ = cv.ChangeHead(file.Sha1)
+	answer, _ := cv.Append(ChatRoleAssistant, "another answer")
+	cv.Append(ChatRoleUser, "dropped question")
+	cv.Append(ChatRoleAssistant, "dropped answer")
+	question, _ := cv.Append(ChatRoleUser, "question")
+
+	kept, excluded := cv.RequestMessages()
+	if got := strings.Join(shas(kept), ","); got != strings.Join([]string{file.Sha1, answer.Sha1, question.Sha1}, ",") || len(excluded) != 2 {
+		t.Fatalf("Expected the turn of the pinned attachment and the question, but got %v and %v", shas(kept), shas(excluded))
+	}
+	if !strings.HasPrefix(kept[0].Content, "Pinned message") || !strings.Contains(kept[0].Content, "side question") {
+		t.Errorf("Expected the pinned message from another branch to be merged into the first message, but got %q", kept[0].Content)
+	}
+}
+
+func TestRequestMessagesKeepsTurnOfPinnedReply(t *testing.T) {
+	profile := config.InitialProfile()
+	profile.ContextStrategy = config.ContextStrategy{Type: config.ContextStrategyLast, KeepLast: 1}
+	cv := NewConversation(profile)
+
+	cv.Append(ChatRoleUser, "first question")
+	reply, _ := cv.Append(ChatRoleAssistant, "first answer")
+	reply.Pinned = true
+	_ = cv.Modify(reply)
+	cv.Append(ChatRoleUser, "second question")
+	cv.Append(ChatRoleAssistant, "second answer")
+	cv.Append(ChatRoleUser, "third question")
+
+	kept, _ := cv.RequestMessages()
+	if len(kept) != 3 {
+		t.Fatalf("Expected the turn of the pinned reply and the question, but got %v", shas(kept))
+	}
+	for i, message := range kept {
+		if want := []string{ChatRoleUser, ChatRoleAssistant}[i%2]; message.Role != want {
+			t.Errorf("Expected the roles to alternate, but got %s at %d", message.Role, i)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/kznrluk/aski/pkg/token"
+	"io"
+	"strings"
+)
+
+const (
+	FormatOpenAI    = "openai"
+	FormatAnthropic = "anthropic"
+)
+
+// DefaultMaxTokens is the largest example accepted by OpenAI chat fine-tuning.
+const DefaultMaxTokens = 16385
+
+// Example - A path of a conversation used as a single training example.
+type Example struct {
+	Source   string
+	Leaf     string
+	System   string
+	Messages []conv.Message
+}
+
+// Problem - An example that was left out and why.
+type Problem struct {
+	Source string
+	Leaf   string
+	Reason string
+}
+
+type (
+	openAIMessage struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+
+	openAIExample struct {
+		Messages []openAIMessage `json:"messages"`
+	}
+
+	anthropicExample struct {
+		System   string          `json:"system,omitempty"`
+		Messages []openAIMessage `json:"messages"`
+	}
+)
+
+// Examples returns the paths of the conversation as examples. Without a tag every path from the root
+// to a leaf is returned, otherwise every path from the root to a message tagged with the tag.
+func Examples(cv conv.Conversation, tag string) []Example {
+	hasChildren := map[string]bool{}
+	for _, m := range cv.GetMessages() {
+		hasChildren[m.ParentSha1] = true
+	}
+
+	var examples []Example
+	for _, m := range cv.GetMessages() {
+		if tag == "" && hasChildren[m.Sha1] {
+			continue
+		}
+		if tag != "" && !m.HasTag(tag) {
+			continue
+		}
+
+		chain, err := cv.MessagesTo(m.Sha1)
+		if err != nil {
+			continue
+		}
+
+		examples = append(examples, Example{
+			Source:   cv.GetFilename(),
+			Leaf:     m.Sha1,
+			System:   cv.SystemOf(m),
+			Messages: chain,
+		})
+	}
+	return examples
+}
+
+// Normalize prepares the example for training and validates it. Consecutive user messages such as
+// file attachments are merged and unanswered user messages at the end are dropped.
+// Roles must then alternate starting from a user message, and the estimated tokens must not exceed maxTokens.
+func Normalize(e Example, maxTokens int) (Example, error) {
+	var messages []conv.Message
+	for _, m := range e.Messages {
+		last := len(messages) - 1
+		if last >= 0 && m.Role == conv.ChatRoleUser && messages[last].Role == conv.ChatRoleUser {
+			messages[last].Content += "\n\n" + m.Content
+			continue
+		}
+		messages = append(messages, m)
+	}
+
+	for len(messages) > 0 && messages[len(messages)-1].Role != conv.ChatRoleAssistant {
+		messages = messages[:len(messages)-1]
+	}
+
+	if len(messages) == 0 {
+		return e, fmt.Errorf("no assistant message")
+	}
+
+	for i, m := range messages {
+		expected := conv.ChatRoleUser
+		if i%2 == 1 {
+			expected = conv.ChatRoleAssistant
+		}
+		if m.Role != expected {
+			return e, fmt.Errorf("roles do not alternate at [%.6s], expected %s but got %s", m.Sha1, expected, m.Role)
+		}
+	}
+
+	tokens := token.EstimateMessage(e.System) + conv.EstimateTokens(messages)
+	if maxTokens > 0 && tokens > maxTokens {
+		return e, fmt.Errorf("~%d tokens exceeds the limit of %d", tokens, maxTokens)
+	}
+
+	e.Messages = messages
+	return e, nil
+}
+
+// Write writes the examples as JSON Lines in the given format.
+func Write(w io.Writer, examples []Example, format string) error {
+	encoder := json.NewEncoder(w)
+	for _, e := range examples {
+		var messages []openAIMessage
+		for _, m := range e.Messages {
+			messages = append(messages, openAIMessage{Role: m.Role, Content: m.Content})
+		}
+
+		var line interface{}
+		switch strings.ToLower(format) {
+		case FormatOpenAI, "":
+			if e.System != "" {
+				messages = append([]openAIMessage{{Role: "system", Content: e.System}}, messages...)
+			}
+			line = openAIExample{Messages: messages}
+		case FormatAnthropic:
+			line = anthropicExample{System: e.System, Messages: messages}
+		default:
+			return fmt.Errorf("unknown dataset format: %s, must be openai or anthropic", format)
+		}
+
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
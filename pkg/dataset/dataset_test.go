@@ -0,0 +1,60 @@
+package dataset
+
+import (
+	"bytes"
+	"github.com/kznrluk/aski/pkg/conv"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		roles    []string
+		expected int
+		wantErr  bool
+	}{
+		{name: "Alternating", roles: []string{"user", "assistant", "user", "assistant"}, expected: 4},
+		{name: "Attachments are merged", roles: []string{"user", "user", "assistant"}, expected: 2},
+		{name: "Unanswered question is dropped", roles: []string{"user", "assistant", "user"}, expected: 2},
+		{name: "Consecutive assistant messages", roles: []string{"user", "assistant", "assistant"}, wantErr: true},
+		{name: "No assistant message", roles: []string{"user"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := Example{System: "system"}
+			for i, role := range tc.roles {
+				e.Messages = append(e.Messages, conv.Message{Sha1: strings.Repeat(string(rune('a'+i)), 6), Role: role, Content: role})
+			}
+
+			normalized, err := Normalize(e, DefaultMaxTokens)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, but got %d messages", len(normalized.Messages))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(normalized.Messages) != tc.expected {
+				t.Errorf("Expected %d messages, but got %d", tc.expected, len(normalized.Messages))
+			}
+		})
+	}
+}
+
+func TestWriteOpenAIIncludesSystem(t *testing.T) {
+	e := Example{System: "be nice", Messages: []conv.Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}}
+
+	var b bytes.Buffer
+	if err := Write(&b, []Example{e}, FormatOpenAI); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `{"messages":[{"role":"system","content":"be nice"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}]}` + "\n"
+	if b.String() != expected {
+		t.Errorf("Expected %s, but got %s", expected, b.String())
+	}
+}
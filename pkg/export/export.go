@@ -0,0 +1,182 @@
+package export
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/conv"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	FormatMarkdown = "md"
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+	FormatText     = "txt"
+)
+
+// Options - Selects the format and the messages to export.
+// By default, the chain from the root to HEAD is exported.
+type Options struct {
+	Format string
+	// Branch exports the chain from the root to the message matching this SHA1 prefix.
+	Branch string
+	// All exports every message of the conversation tree.
+	All bool
+}
+
+// node is a message with its children. The child on the selected chain comes first.
+type node struct {
+	message  conv.Message
+	children []*node
+}
+
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "md", "markdown":
+		return FormatMarkdown, nil
+	case "html", "htm":
+		return FormatHTML, nil
+	case "json":
+		return FormatJSON, nil
+	case "txt", "text":
+		return FormatText, nil
+	default:
+		return "", fmt.Errorf("unknown export format: %s, must be one of md, html, json or txt", format)
+	}
+}
+
+// Export writes the conversation to w in the format given in the options.
+func Export(w io.Writer, cv conv.Conversation, opts Options) error {
+	format, err := ParseFormat(opts.Format)
+	if err != nil {
+		return err
+	}
+
+	chain := cv.MessagesFromHead()
+	if opts.Branch != "" {
+		chain, err = cv.MessagesTo(opts.Branch)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The system prompt is the one the exported chain was sent with, as it may have been changed on other branches.
+	system := cv.GetSystem()
+	if len(chain) > 0 {
+		system = cv.SystemOf(chain[len(chain)-1])
+	}
+
+	var roots []*node
+	if opts.All {
+		roots = buildTree(cv.GetMessages(), chain)
+	} else {
+		roots = buildTree(chain, chain)
+	}
+
+	switch format {
+	case FormatMarkdown:
+		return writeMarkdown(w, cv, system, roots)
+	case FormatHTML:
+		return writeHTML(w, cv, system, roots)
+	case FormatJSON:
+		return writeJSON(w, cv, system, roots)
+	default:
+		return writeText(w, cv, system, roots)
+	}
+}
+
+func buildTree(messages []conv.Message, chain []conv.Message) []*node {
+	onChain := map[string]bool{}
+	for _, message := range chain {
+		onChain[message.Sha1] = true
+	}
+
+	nodes := map[string]*node{}
+	for _, message := range messages {
+		nodes[message.Sha1] = &node{message: message}
+	}
+
+	var roots []*node
+	for _, message := range messages {
+		n := nodes[message.Sha1]
+		parent, ok := nodes[message.ParentSha1]
+		if !ok {
+			roots = appendChild(roots, n, onChain)
+			continue
+		}
+		parent.children = appendChild(parent.children, n, onChain)
+	}
+
+	return roots
+}
+
+func appendChild(children []*node, n *node, onChain map[string]bool) []*node {
+	if onChain[n.message.Sha1] {
+		return append([]*node{n}, children...)
+	}
+	return append(children, n)
+}
+
+// walk visits the thread starting at the node. It follows the first child and reports
+// the other children as branches from the message they are replying to.
+func walk(n *node, visit func(m conv.Message), branch func(from conv.Message, child *node)) {
+	for n != nil {
+		visit(n.message)
+		if len(n.children) == 0 {
+			return
+		}
+		for _, child := range n.children[1:] {
+			branch(n.message, child)
+		}
+		n = n.children[0]
+	}
+}
+
+func labels(m conv.Message) string {
+	var l []string
+	if m.Head {
+		l = append(l, "HEAD")
+	}
+	if m.Summary {
+		l = append(l, "Summary")
+	}
+	if m.Pinned {
+		l = append(l, "Pinned")
+	}
+	for _, tag := range m.Tags {
+		l = append(l, "#"+tag)
+	}
+	return strings.Join(l, ", ")
+}
+
+func speaker(m conv.Message) string {
+	if m.UserName != "" {
+		return fmt.Sprintf("%s (%s)", m.Role, m.UserName)
+	}
+	if m.Model != "" {
+		return fmt.Sprintf("%s (%s)", m.Role, m.Model)
+	}
+	return m.Role
+}
+
+// ToFile writes the conversation to the file at path.
+func ToFile(path string, cv conv.Conversation, opts Options) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return Export(f, cv, opts)
+}
+
+// DefaultFilename returns the file name used when no output path is given.
+func DefaultFilename(cv conv.Conversation, format string) string {
+	name := strings.TrimSuffix(cv.GetFilename(), ".yaml")
+	if name == "" {
+		name = time.Now().Format("20060102-150405")
+	}
+	return name + "." + format
+}
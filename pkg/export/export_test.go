@@ -0,0 +1,153 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// branched returns a conversation with two answers to the same question. HEAD is on the second one.
+func branched(t *testing.T) (conv.Conversation, conv.Message, conv.Message) {
+	t.Helper()
+	cv := conv.NewConversation(config.InitialProfile())
+	question, _ := cv.Append(conv.ChatRoleUser, "Question")
+	first, _ := cv.Append(conv.ChatRoleAssistant, "First answer")
+	if _, err := cv.ChangeHead(question.Sha1); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := cv.Append(conv.ChatRoleAssistant, "Second answer")
+	return cv, first, second
+}
+
+func TestExportMarkdown(t *testing.T) {
+	cv, first, second := branched(t)
+	question := cv.MessagesFromHead()[0]
+
+	tests := []struct {
+		name     string
+		opts     Options
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "head",
+			opts:     Options{},
+			contains: []string{"# aski conversation\n", "### user", "Question", fmt.Sprintf("`%.6s` _HEAD_\n\nSecond answer", second.Sha1)},
+			excludes: []string{"First answer", "<details>"},
+		},
+		{
+			name: "all",
+			opts: Options{All: true},
+			contains: []string{
+				"Question\n\n<details>\n<summary>Branch from " + question.Sha1[:6] + "</summary>",
+				fmt.Sprintf("`%.6s`\n\nFirst answer\n\n</details>\n\n---", first.Sha1),
+				"_HEAD_\n\nSecond answer",
+			},
+		},
+		{
+			name:     "branch",
+			opts:     Options{Branch: first.Sha1[:6]},
+			contains: []string{"Question", "First answer"},
+			excludes: []string{"Second answer", "<details>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			tt.opts.Format = FormatMarkdown
+			if err := Export(&b, cv, tt.opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(b.String(), s) {
+					t.Errorf("Expected %q in:\n%s", s, b.String())
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(b.String(), s) {
+					t.Errorf("Expected no %q in:\n%s", s, b.String())
+				}
+			}
+		})
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	cv, first, second := branched(t)
+	question := cv.MessagesFromHead()[0]
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{name: "head", opts: Options{}, expected: []string{question.Sha1, second.Sha1}},
+		{name: "all", opts: Options{All: true}, expected: []string{question.Sha1, first.Sha1, second.Sha1}},
+		{name: "branch", opts: Options{Branch: first.Sha1[:6]}, expected: []string{question.Sha1, first.Sha1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			tt.opts.Format = "JSON"
+			if err := Export(&b, cv, tt.opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var out jsonConversation
+			if err := json.Unmarshal(b.Bytes(), &out); err != nil {
+				t.Fatalf("Expected valid JSON, but got %v", err)
+			}
+			var shas []string
+			for _, m := range out.Messages {
+				shas = append(shas, m.Sha1)
+				if m.Head != (m.Sha1 == second.Sha1) {
+					t.Errorf("Expected HEAD only on the second answer, but got %+v", m)
+				}
+			}
+			if !reflect.DeepEqual(shas, tt.expected) {
+				t.Errorf("Expected messages %v, but got %v", tt.expected, shas)
+			}
+			if out.Name != "aski conversation" || out.Messages[1].ParentSha1 != question.Sha1 {
+				t.Errorf("Unexpected conversation %+v", out)
+			}
+		})
+	}
+}
+
+func TestExportSystemOfBranch(t *testing.T) {
+	cv := conv.NewConversation(config.InitialProfile())
+	cv.SetSystem("Old system")
+	question, _ := cv.Append(conv.ChatRoleUser, "Question")
+	first, _ := cv.Append(conv.ChatRoleAssistant, "First answer")
+	if _, err := cv.ChangeHead(question.Sha1); err != nil {
+		t.Fatal(err)
+	}
+	cv.ChangeSystem("New system")
+	cv.Append(conv.ChatRoleAssistant, "Second answer")
+
+	for _, format := range []string{FormatMarkdown, FormatHTML, FormatJSON, FormatText} {
+		var b bytes.Buffer
+		if err := Export(&b, cv, Options{Format: format, Branch: first.Sha1[:6]}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(b.String(), "Old system") || strings.Contains(b.String(), "New system") {
+			t.Errorf("Expected the system prompt of the exported branch in %s, but got %s", format, b.String())
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if format, err := ParseFormat(".Markdown"); err != nil || format != FormatMarkdown {
+		t.Errorf("Expected md, but got %q, %v", format, err)
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
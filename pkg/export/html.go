@@ -0,0 +1,139 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+	"html"
+	"io"
+	"strings"
+)
+
+const htmlStyle = `body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+.message { border: 1px solid #d0d7de; border-radius: 6px; margin: 1em 0; padding: 0 1em; }
+.message.user { background: #f6f8fa; }
+.message.system { background: #fff8c5; }
+.header { font-size: 0.85em; color: #57606a; padding-top: 0.5em; }
+.header code { color: #0969da; }
+.labels { font-weight: bold; }
+details { border-left: 3px solid #d0d7de; padding-left: 1em; margin: 1em 0; }
+summary { cursor: pointer; color: #57606a; }
+pre { padding: 0.8em; overflow-x: auto; border-radius: 6px; }
+`
+
+const codeStyle = "github"
+
+func writeHTML(w io.Writer, cv conv.Conversation, system string, roots []*node) error {
+	style := styles.Get(codeStyle)
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	md := goldmark.New(goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&codeBlockRenderer{formatter: formatter, style: style}, 100)),
+	))
+
+	var b bytes.Buffer
+	profile := cv.GetProfile()
+	name := html.EscapeString(title(cv))
+
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s", name, htmlStyle)
+	if err := formatter.WriteCSS(&b, style); err != nil {
+		return err
+	}
+	fmt.Fprintf(&b, "</style>\n</head>\n<body>\n<h1>%s</h1>\n", name)
+	fmt.Fprintf(&b, "<p>Profile: %s, Model: %s</p>\n", html.EscapeString(profile.ProfileName), html.EscapeString(profile.Model))
+
+	var renderErr error
+	message := func(role string, header string, content string) {
+		fmt.Fprintf(&b, "<div class=\"message %s\">\n<div class=\"header\">%s</div>\n", html.EscapeString(role), header)
+		if err := md.Convert([]byte(content), &b); err != nil && renderErr == nil {
+			renderErr = err
+		}
+		b.WriteString("</div>\n")
+	}
+
+	if system != "" {
+		message("system", "system", system)
+	}
+
+	var thread func(n *node)
+	thread = func(n *node) {
+		walk(n, func(m conv.Message) {
+			header := fmt.Sprintf("%s <code>%.6s</code>", html.EscapeString(speaker(m)), m.Sha1)
+			if l := labels(m); l != "" {
+				header += fmt.Sprintf(" <span class=\"labels\">%s</span>", l)
+			}
+			message(m.Role, header, m.Content)
+		}, func(from conv.Message, child *node) {
+			fmt.Fprintf(&b, "<details>\n<summary>Branch from <code>%.6s</code></summary>\n", from.Sha1)
+			thread(child)
+			b.WriteString("</details>\n")
+		})
+	}
+
+	for i, root := range roots {
+		if i == 0 {
+			thread(root)
+			continue
+		}
+		b.WriteString("<details>\n<summary>Branch from ROOT</summary>\n")
+		thread(root)
+		b.WriteString("</details>\n")
+	}
+
+	b.WriteString("</body>\n</html>\n")
+	if renderErr != nil {
+		return renderErr
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// codeBlockRenderer renders fenced code blocks with syntax highlighting.
+type codeBlockRenderer struct {
+	formatter *chromahtml.Formatter
+	style     *chroma.Style
+}
+
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.render)
+}
+
+func (r *codeBlockRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	block := n.(*ast.FencedCodeBlock)
+	var code strings.Builder
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	lexer := lexers.Get(string(block.Language(source)))
+	if lexer == nil {
+		lexer = lexers.Analyse(code.String())
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	if err := r.formatter.Format(w, r.style, iterator); err != nil {
+		return ast.WalkStop, err
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,76 @@
+package export
+
+import (
+	"encoding/json"
+	"github.com/kznrluk/aski/pkg/conv"
+	"io"
+)
+
+type (
+	jsonConversation struct {
+		Name     string        `json:"name"`
+		Profile  string        `json:"profile"`
+		Model    string        `json:"model"`
+		System   string        `json:"system"`
+		Messages []jsonMessage `json:"messages"`
+	}
+
+	jsonMessage struct {
+		Sha1       string   `json:"sha1"`
+		ParentSha1 string   `json:"parent_sha1"`
+		Role       string   `json:"role"`
+		UserName   string   `json:"user_name,omitempty"`
+		Content    string   `json:"content"`
+		Model      string   `json:"model,omitempty"`
+		Profile    string   `json:"profile,omitempty"`
+		Head       bool     `json:"head,omitempty"`
+		Summary    bool     `json:"summary,omitempty"`
+		Pinned     bool     `json:"pinned,omitempty"`
+		Tags       []string `json:"tags,omitempty"`
+		Attachment string   `json:"attachment,omitempty"`
+	}
+)
+
+func writeJSON(w io.Writer, cv conv.Conversation, system string, roots []*node) error {
+	profile := cv.GetProfile()
+	out := jsonConversation{
+		Name:     title(cv),
+		Profile:  profile.ProfileName,
+		Model:    profile.Model,
+		System:   system,
+		Messages: []jsonMessage{},
+	}
+
+	var thread func(n *node)
+	thread = func(n *node) {
+		walk(n, func(m conv.Message) {
+			jm := jsonMessage{
+				Sha1:       m.Sha1,
+				ParentSha1: m.ParentSha1,
+				Role:       m.Role,
+				UserName:   m.UserName,
+				Content:    m.Content,
+				Model:      m.Model,
+				Profile:    m.Profile,
+				Head:       m.Head,
+				Summary:    m.Summary,
+				Pinned:     m.Pinned,
+				Tags:       m.Tags,
+			}
+			if m.Attachment != nil {
+				jm.Attachment = m.Attachment.Label()
+			}
+			out.Messages = append(out.Messages, jm)
+		}, func(from conv.Message, child *node) {
+			thread(child)
+		})
+	}
+
+	for _, root := range roots {
+		thread(root)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
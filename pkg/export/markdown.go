@@ -0,0 +1,95 @@
+package export
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/conv"
+	"io"
+	"strings"
+)
+
+func writeMarkdown(w io.Writer, cv conv.Conversation, system string, roots []*node) error {
+	var b strings.Builder
+	profile := cv.GetProfile()
+
+	fmt.Fprintf(&b, "# %s\n\n", title(cv))
+	fmt.Fprintf(&b, "- Profile: %s\n- Model: %s\n\n", profile.ProfileName, profile.Model)
+	if system != "" {
+		fmt.Fprintf(&b, "## System\n\n%s\n\n", system)
+	}
+
+	var thread func(n *node)
+	thread = func(n *node) {
+		walk(n, func(m conv.Message) {
+			fmt.Fprintf(&b, "---\n\n### %s `%.6s`", speaker(m), m.Sha1)
+			if l := labels(m); l != "" {
+				fmt.Fprintf(&b, " _%s_", l)
+			}
+			fmt.Fprintf(&b, "\n\n%s\n\n", strings.TrimSpace(m.Content))
+		}, func(from conv.Message, child *node) {
+			fmt.Fprintf(&b, "<details>\n<summary>Branch from %.6s</summary>\n\n", from.Sha1)
+			thread(child)
+			fmt.Fprintf(&b, "</details>\n\n")
+		})
+	}
+
+	for i, root := range roots {
+		if i == 0 {
+			thread(root)
+			continue
+		}
+		fmt.Fprintf(&b, "<details>\n<summary>Branch from ROOT</summary>\n\n")
+		thread(root)
+		fmt.Fprintf(&b, "</details>\n\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeText(w io.Writer, cv conv.Conversation, system string, roots []*node) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s\n\n", title(cv))
+	if system != "" {
+		fmt.Fprintf(&b, "[system]\n%s\n\n", system)
+	}
+
+	var thread func(n *node, depth int)
+	thread = func(n *node, depth int) {
+		indent := strings.Repeat("    ", depth)
+		walk(n, func(m conv.Message) {
+			fmt.Fprintf(&b, "%s[%.6s] %s -> [%.6s]", indent, m.Sha1, speaker(m), m.ParentSha1)
+			if l := labels(m); l != "" {
+				fmt.Fprintf(&b, " %s", l)
+			}
+			b.WriteString("\n")
+			for _, line := range strings.Split(strings.TrimSpace(m.Content), "\n") {
+				fmt.Fprintf(&b, "%s%s\n", indent, line)
+			}
+			b.WriteString("\n")
+		}, func(from conv.Message, child *node) {
+			fmt.Fprintf(&b, "%s    --- branch from [%.6s] ---\n", indent, from.Sha1)
+			thread(child, depth+1)
+		})
+	}
+
+	for i, root := range roots {
+		if i > 0 {
+			b.WriteString("    --- branch from ROOT ---\n")
+		}
+		thread(root, min(i, 1))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func title(cv conv.Conversation) string {
+	if cv.GetTitle() != "" {
+		return cv.GetTitle()
+	}
+	if cv.GetFilename() != "" {
+		return strings.TrimSuffix(cv.GetFilename(), ".yaml")
+	}
+	return "aski conversation"
+}
@@ -0,0 +1,248 @@
+package file
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/token"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Report - What happened to an attached file under the budgets.
+type Report struct {
+	Path   string
+	Bytes  int
+	Tokens int
+	// Sent is the estimated tokens sent after truncation.
+	Sent   int
+	Action string
+}
+
+// ErrOverBudget is returned with the refuse strategy when a file or the total exceeds its budget.
+type ErrOverBudget struct {
+	// Path is empty when the total budget is exceeded.
+	Path   string
+	Budget config.Size
+}
+
+func (e *ErrOverBudget) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("attached files exceed the total budget of %s", e.Budget)
+	}
+	return fmt.Sprintf("%s exceeds the budget of %s", e.Path, e.Budget)
+}
+
+// ApplyLimits fits the files in the per-file and total budgets. Files are taken in order, and once the total
+// budget is used up the remaining files are skipped, unless the strategy is refuse.
+func ApplyLimits(files []FileContents, limits config.AttachmentLimits) ([]FileContents, []Report, error) {
+	perFile, err := config.ParseSize(limits.MaxFileSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	total, err := config.ParseSize(limits.MaxTotalSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	strategy := limits.Strategy
+	switch strategy {
+	case "":
+		strategy = config.AttachmentStrategyRefuse
+	case config.AttachmentStrategyRefuse, config.AttachmentStrategyTruncate, config.AttachmentStrategyHeadTail:
+	default:
+		return nil, nil, fmt.Errorf("unknown attachment strategy: %s, must be refuse, truncate or headtail", strategy)
+	}
+
+	var kept []FileContents
+	var reports []Report
+	var refused error
+	used := config.Size{}
+
+	for _, f := range files {
+		r := Report{Path: f.Label(), Bytes: f.Length, Tokens: token.Estimate(f.Contents)}
+
+		budget := perFile
+		if !total.IsZero() {
+			budget = smaller(budget, config.Size{Bytes: subtract(total.Bytes, used.Bytes), Tokens: subtract(total.Tokens, used.Tokens)})
+		}
+
+		if !fits(f.Contents, budget) {
+			overTotal := fits(f.Contents, perFile)
+			switch {
+			case strategy == config.AttachmentStrategyRefuse:
+				if refused == nil {
+					refused = &ErrOverBudget{Path: f.Label(), Budget: perFile}
+					if overTotal {
+						refused = &ErrOverBudget{Budget: total}
+					}
+				}
+				r.Action = "over budget"
+				reports = append(reports, r)
+				continue
+			case budget.Bytes < 0 || budget.Tokens < 0:
+				r.Action = "skipped, total budget used"
+				reports = append(reports, r)
+				continue
+			case strategy == config.AttachmentStrategyHeadTail:
+				f.Contents = headTail(f.Contents, budget)
+				r.Action = "head/tail"
+			default:
+				f.Contents = truncate(f.Contents, budget)
+				r.Action = "truncated"
+			}
+
+			// The marker alone may not fit in what is left of the budget.
+			if !fits(f.Contents, budget) {
+				r.Action = "skipped, budget too small"
+				reports = append(reports, r)
+				continue
+			}
+		}
+
+		r.Sent = token.Estimate(f.Contents)
+		f.Length = len(f.Contents)
+		used.Bytes += f.Length
+		used.Tokens += r.Sent
+		kept = append(kept, f)
+		reports = append(reports, r)
+	}
+
+	if refused != nil {
+		for i := range reports {
+			reports[i].Sent = 0
+		}
+		return nil, reports, refused
+	}
+	return kept, reports, nil
+}
+
+// Limited reports whether any file was truncated or skipped by the budgets.
+func Limited(reports []Report) bool {
+	for _, r := range reports {
+		if r.Action != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintReports writes the reports as a table with the total.
+func PrintReports(w io.Writer, reports []Report) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "FILE\tBYTES\t~TOKENS\tNOTE")
+
+	bytes, tokens := 0, 0
+	for _, r := range reports {
+		estimate := fmt.Sprintf("%d", r.Tokens)
+		if r.Sent > 0 && r.Sent != r.Tokens {
+			estimate = fmt.Sprintf("%d -> %d", r.Tokens, r.Sent)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", r.Path, r.Bytes, estimate, r.Action)
+
+		bytes += r.Bytes
+		tokens += r.Sent
+	}
+
+	_, _ = fmt.Fprintf(tw, "TOTAL\t%d\t%d sent\t\n", bytes, tokens)
+	_ = tw.Flush()
+}
+
+func fits(content string, budget config.Size) bool {
+	if budget.Bytes != 0 && len(content) > budget.Bytes {
+		return false
+	}
+	if budget.Tokens != 0 && token.Estimate(content) > budget.Tokens {
+		return false
+	}
+	return true
+}
+
+// smaller returns the stricter of two budgets for each unit. Zero is unlimited.
+func smaller(a, b config.Size) config.Size {
+	pick := func(x, y int) int {
+		if x == 0 {
+			return y
+		}
+		if y == 0 || x < y {
+			return x
+		}
+		return y
+	}
+	return config.Size{Bytes: pick(a.Bytes, b.Bytes), Tokens: pick(a.Tokens, b.Tokens)}
+}
+
+// subtract returns the remaining budget, or -1 when an enabled budget is used up.
+func subtract(limit, used int) int {
+	if limit == 0 {
+		return 0
+	}
+	if used >= limit {
+		return -1
+	}
+	return limit - used
+}
+
+const truncationMarker = "\n... [%d bytes truncated by aski] ...\n"
+
+func truncate(content string, budget config.Size) string {
+	marker := fmt.Sprintf(truncationMarker, len(content))
+	head := prefixFitting(content, reserve(budget, marker))
+	return head + fmt.Sprintf(truncationMarker, len(content)-len(head))
+}
+
+func headTail(content string, budget config.Size) string {
+	marker := fmt.Sprintf(truncationMarker, len(content))
+	half := reserve(budget, marker)
+	half = config.Size{Bytes: half.Bytes / 2, Tokens: half.Tokens / 2}
+	if half.Bytes == 0 && budget.Bytes != 0 {
+		half.Bytes = 1
+	}
+	if half.Tokens == 0 && budget.Tokens != 0 {
+		half.Tokens = 1
+	}
+
+	head := prefixFitting(content, half)
+	tail := reverse(prefixFitting(reverse(content[len(head):]), half))
+	return head + fmt.Sprintf(truncationMarker, len(content)-len(head)-len(tail)) + tail
+}
+
+// reserve subtracts the size of the marker from the budget, keeping at least one unit.
+func reserve(budget config.Size, marker string) config.Size {
+	r := budget
+	if r.Bytes > 0 {
+		r.Bytes = max(1, r.Bytes-len(marker))
+	}
+	if r.Tokens > 0 {
+		r.Tokens = max(1, r.Tokens-token.Estimate(marker))
+	}
+	return r
+}
+
+// prefixFitting returns the longest prefix of whole lines, or runes for a single long line, that fits in the budget.
+func prefixFitting(content string, budget config.Size) string {
+	runes := []rune(content)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(string(runes[:mid]), budget) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	prefix := string(runes[:lo])
+	if i := strings.LastIndexByte(prefix, '\n'); i > 0 && lo < len(runes) {
+		prefix = prefix[:i+1]
+	}
+	return prefix
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,84 @@
+package file
+
+import (
+	"errors"
+	"github.com/kznrluk/aski/pkg/config"
+	"strings"
+	"testing"
+)
+
+func lines(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString("line of text number ")
+		b.WriteString(strings.Repeat("x", i%7))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func attachment(path, contents string) FileContents {
+	return FileContents{Path: path, Contents: contents, Length: len(contents)}
+}
+
+func TestApplyLimitsRefuse(t *testing.T) {
+	files := []FileContents{attachment("small.go", "package a\n"), attachment("big.go", lines(200))}
+
+	_, reports, err := ApplyLimits(files, config.AttachmentLimits{MaxFileSize: "1KB"})
+	var over *ErrOverBudget
+	if !errors.As(err, &over) || over.Path != "big.go" {
+		t.Fatalf("Expected big.go to be refused, but got %v", err)
+	}
+	if len(reports) != 2 || reports[1].Action != "over budget" {
+		t.Errorf("Unexpected reports: %+v", reports)
+	}
+}
+
+func TestApplyLimitsTruncate(t *testing.T) {
+	big := lines(200)
+	files := []FileContents{attachment("big.go", big)}
+
+	for _, strategy := range []string{config.AttachmentStrategyTruncate, config.AttachmentStrategyHeadTail} {
+		kept, reports, err := ApplyLimits(files, config.AttachmentLimits{MaxFileSize: "1KB", Strategy: strategy})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(kept) != 1 || len(kept[0].Contents) > 1024 {
+			t.Fatalf("Expected the file to fit in 1KB with %s, but got %d bytes", strategy, len(kept[0].Contents))
+		}
+		if !strings.Contains(kept[0].Contents, "truncated by aski") || !strings.HasPrefix(kept[0].Contents, "line of text") {
+			t.Errorf("Expected a marker after the head with %s", strategy)
+		}
+		if strategy == config.AttachmentStrategyHeadTail && !strings.HasSuffix(kept[0].Contents, big[len(big)-30:]) {
+			t.Errorf("Expected the end of the file to be kept with headtail")
+		}
+		if reports[0].Action == "" || reports[0].Sent >= reports[0].Tokens {
+			t.Errorf("Unexpected report: %+v", reports[0])
+		}
+	}
+}
+
+func TestApplyLimitsTotalTokens(t *testing.T) {
+	files := []FileContents{
+		attachment("a.go", lines(40)),
+		attachment("b.go", lines(40)),
+		attachment("c.go", lines(40)),
+		attachment("d.go", lines(40)),
+	}
+
+	kept, reports, err := ApplyLimits(files, config.AttachmentLimits{MaxTotalSize: "500tokens", Strategy: config.AttachmentStrategyTruncate})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	total := 0
+	for _, r := range reports {
+		total += r.Sent
+	}
+	if total > 500 {
+		t.Errorf("Expected at most 500 tokens, but got %d", total)
+	}
+	if len(kept) != 3 || reports[2].Action != "truncated" || !strings.HasPrefix(reports[3].Action, "skipped") {
+		t.Errorf("Unexpected reports: %+v", reports)
+	}
+}
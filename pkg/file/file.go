@@ -1,9 +1,18 @@
 package file
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/kznrluk/aski/pkg/conv"
 	"github.com/kznrluk/aski/pkg/util"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 type FileContents struct {
@@ -11,37 +20,215 @@ type FileContents struct {
 	Path     string
 	Contents string
 	Length   int
+	// ModTime and Hash describe the file as it was read, before any truncation.
+	ModTime time.Time
+	Hash    string
+	// Symbol, StartLine and EndLine are set when only a part of the file is attached. The lines are 1-based.
+	Symbol    string
+	StartLine int
+	EndLine   int
+	// Kind is set for contents that do not come from a file, such as git diffs. Path holds the command then.
+	Kind string
 }
 
-func GetFileContents(fileGlobs []string) []FileContents {
-	var fileContents []FileContents
+// Options - How file globs are expanded. Files matched by a glob are skipped when they are ignored by
+// .gitignore or .askiignore files, unless NoIgnore is set. Exclude patterns use the same syntax and
+// apply to every file, including the ones named explicitly.
+type Options struct {
+	Exclude  []string
+	NoIgnore bool
+}
+
+// ErrInvalidPattern is returned for a glob that cannot be parsed, such as one with an unclosed bracket.
+var ErrInvalidPattern = errors.New("invalid file pattern")
+
+// Skipped - A file or directory that was not attached and why.
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+// GetFileContents reads the files matching the globs. Globs support ** to match any number of directories,
+// and a directory attaches the files below it. A line range such as path:10-80 or a symbol such as path#Name
+// attaches only that part of each file. Files that cannot be read are skipped, but an invalid glob is an error.
+func GetFileContents(fileGlobs []string, opts Options) ([]FileContents, []Skipped, error) {
+	ig := newIgnorer(opts.Exclude, !opts.NoIgnore)
+	c := collector{ig: ig, seen: map[string]bool{}}
+
 	for _, arg := range fileGlobs {
-		files, err := filepath.Glob(arg)
+		path, sel, err := ParseSelection(arg)
 		if err != nil {
-			panic(err)
+			c.skip(arg, err.Error())
+			continue
 		}
-		for _, file := range files {
-			contentsBytes, err := os.ReadFile(file)
+		c.sel = sel
+
+		if !strings.ContainsAny(path, "*?[{") {
+			info, err := os.Stat(path)
 			if err != nil {
-				panic(err)
+				c.skip(path, err.Error())
+				continue
 			}
-			content := string(contentsBytes)
-			if util.IsBinary(contentsBytes) {
+			if !info.IsDir() {
+				if excluded, source := ig.excluded(path, false); excluded {
+					c.skip(path, "ignored by "+source)
+					continue
+				}
+				c.add(path)
 				continue
 			}
+			path = filepath.Join(path, "**")
+		}
 
-			info, err := os.Stat(file)
-			if err != nil {
-				panic(err)
+		pattern := filepath.ToSlash(filepath.Clean(path))
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, nil, fmt.Errorf("%w: %s, check the brackets and braces or quote them", ErrInvalidPattern, path)
+		}
+		base, rest := doublestar.SplitPattern(pattern)
+		c.walk(filepath.FromSlash(base), rest)
+	}
+
+	return c.contents, c.skipped, nil
+}
+
+type collector struct {
+	ig *ignorer
+	// sel is the selection of the argument being expanded.
+	sel      Selection
+	seen     map[string]bool
+	contents []FileContents
+	skipped  []Skipped
+}
+
+// walk reads the files below base matching the pattern, without descending into ignored directories.
+func (c *collector) walk(base string, pattern string) {
+	maxDepth := -1
+	if !strings.Contains(pattern, "**") {
+		maxDepth = strings.Count(pattern, "/")
+	}
+
+	_ = filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != base {
+				c.skip(path, err.Error())
 			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		depth := strings.Count(rel, "/")
+
+		if d.IsDir() {
+			if maxDepth >= 0 && depth >= maxDepth {
+				return filepath.SkipDir
+			}
+			if ignored, source := c.ig.ignored(path, true); ignored {
+				if source != ".git" {
+					c.skip(path+string(filepath.Separator), "ignored by "+source)
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
-			fileContents = append(fileContents, FileContents{
-				Name:     info.Name(),
-				Path:     file,
-				Contents: content,
-				Length:   len(content),
-			})
+		if matched, _ := doublestar.Match(pattern, rel); !matched {
+			return nil
 		}
+		if ignored, source := c.ig.ignored(path, false); ignored {
+			c.skip(path, "ignored by "+source)
+			return nil
+		}
+		c.add(path)
+		return nil
+	})
+}
+
+func (c *collector) add(file string) {
+	abs, err := filepath.Abs(file)
+	if err == nil {
+		if c.seen[abs+c.sel.String()] {
+			return
+		}
+		c.seen[abs+c.sel.String()] = true
+	}
+
+	f, err := Read(file)
+	if err == nil {
+		f, err = c.sel.Apply(f)
+	}
+	if err != nil {
+		c.skip(file+c.sel.String(), err.Error())
+		return
+	}
+	c.contents = append(c.contents, f)
+}
+
+// Read reads a text file. Binary files are an error.
+func Read(file string) (FileContents, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return FileContents{}, err
+	}
+
+	contentsBytes, err := os.ReadFile(file)
+	if err != nil {
+		return FileContents{}, err
+	}
+	if util.IsBinary(contentsBytes) {
+		return FileContents{}, fmt.Errorf("binary file")
+	}
+
+	content := string(contentsBytes)
+	return FileContents{
+		Name:     filepath.Base(file),
+		Path:     file,
+		Contents: content,
+		Length:   len(content),
+		ModTime:  info.ModTime(),
+		Hash:     Hash(content),
+	}, nil
+}
+
+// Hash returns the SHA-256 of the contents in hex.
+func Hash(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+// Attachment describes the file for the attachment message created from it.
+func (f FileContents) Attachment() conv.Attachment {
+	if f.Kind != "" {
+		return conv.Attachment{Path: f.Path, Kind: f.Kind}
+	}
+
+	source, err := filepath.Abs(f.Path)
+	if err != nil {
+		source = f.Path
+	}
+	return conv.Attachment{
+		Path:      f.Path,
+		Source:    source,
+		ModTime:   f.ModTime,
+		Hash:      f.Hash,
+		Symbol:    f.Symbol,
+		StartLine: f.StartLine,
+		EndLine:   f.EndLine,
+	}
+}
+
+// Label returns the path with the attached part, such as main.go:10-80 or main.go#main.
+func (f FileContents) Label() string {
+	return f.Attachment().Label()
+}
+
+func (c *collector) skip(path string, reason string) {
+	if c.seen["skip:"+path] {
+		return
 	}
-	return fileContents
+	c.seen["skip:"+path] = true
+	c.skipped = append(c.skipped, Skipped{Path: path, Reason: reason})
 }
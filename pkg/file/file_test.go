@@ -0,0 +1,97 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetFileContentsRespectsIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".git/HEAD":                "ref",
+		".gitignore":               "node_modules/\n*.log\n!keep.log\n",
+		"pkg/.askiignore":          "/generated.go\n",
+		"main.go":                  "package main",
+		"pkg/lib.go":               "package pkg",
+		"pkg/generated.go":         "package pkg",
+		"pkg/sub/generated.go":     "package sub",
+		"pkg/debug.log":            "log",
+		"pkg/keep.log":             "log",
+		"node_modules/dep/dep.go":  "package dep",
+		"vendor/example/vendor.go": "package example",
+	})
+
+	contents, skipped, _ := GetFileContents([]string{filepath.Join(dir, "**")}, Options{Exclude: []string{"vendor/"}})
+
+	var attached []string
+	for _, c := range contents {
+		rel, _ := filepath.Rel(dir, c.Path)
+		attached = append(attached, filepath.ToSlash(rel))
+	}
+	sort.Strings(attached)
+
+	expected := []string{".gitignore", "main.go", "pkg/.askiignore", "pkg/keep.log", "pkg/lib.go", "pkg/sub/generated.go"}
+	if len(attached) != len(expected) {
+		t.Fatalf("Expected %v, but got %v", expected, attached)
+	}
+	for i := range expected {
+		if attached[i] != expected[i] {
+			t.Errorf("Expected %s, but got %s", expected[i], attached[i])
+		}
+	}
+
+	reasons := map[string]string{}
+	for _, s := range skipped {
+		rel, _ := filepath.Rel(dir, s.Path)
+		reasons[filepath.ToSlash(rel)] = s.Reason
+	}
+	if reasons["node_modules"] != "ignored by .gitignore" || reasons["vendor"] != "ignored by --exclude" ||
+		reasons["pkg/generated.go"] != "ignored by .askiignore" || reasons["pkg/debug.log"] != "ignored by .gitignore" {
+		t.Errorf("Unexpected skipped files: %v", reasons)
+	}
+}
+
+func TestGetFileContentsExplicitFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".git/HEAD":  "ref",
+		".gitignore": ".env\n",
+		".env":       "KEY=value",
+		"a.go":       "package a",
+		"sub/b.go":   "package sub",
+	})
+
+	contents, _, _ := GetFileContents([]string{filepath.Join(dir, ".env"), filepath.Join(dir, "*.go"), filepath.Join(dir, "a.go")}, Options{})
+	if len(contents) != 2 || contents[0].Name != ".env" || contents[1].Name != "a.go" {
+		t.Errorf("Expected the explicit file and a single a.go, but got %+v", contents)
+	}
+
+	_, skipped, _ := GetFileContents([]string{filepath.Join(dir, ".env")}, Options{Exclude: []string{".env"}})
+	if len(skipped) != 1 {
+		t.Errorf("Expected the explicit file to be excluded, but got %+v", skipped)
+	}
+}
+
+func TestGetFileContentsInvalidPattern(t *testing.T) {
+	dir := t.TempDir()
+
+	_, _, err := GetFileContents([]string{filepath.Join(dir, "[a.go")}, Options{})
+	if !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("Expected ErrInvalidPattern, but got %v", err)
+	}
+}
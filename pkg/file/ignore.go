@@ -0,0 +1,208 @@
+package file
+
+import (
+	"bufio"
+	"github.com/bmatcuk/doublestar/v4"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ignoreFileNames = []string{".gitignore", ".askiignore"}
+
+// ignoreRule - A line of a .gitignore style file. Patterns without a slash match at any depth below base,
+// or anywhere when base is empty.
+type ignoreRule struct {
+	source   string
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func parseIgnoreRule(line, base, source string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{source: source, base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "\\")
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	rule.pattern = line
+	return rule, true
+}
+
+func (r ignoreRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	base := r.base
+	if base == "" {
+		base = filepath.VolumeName(path) + string(filepath.Separator)
+	}
+
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	pattern := r.pattern
+	if !r.anchored {
+		pattern = "**/" + pattern
+	}
+	matched, _ := doublestar.Match(pattern, rel)
+	return matched
+}
+
+// ignorer decides which files to skip by the .gitignore and .askiignore files from the repository root
+// down to each file, followed by the exclude patterns given on the command line.
+type ignorer struct {
+	useIgnoreFiles bool
+	exclude        []ignoreRule
+	rules          map[string][]ignoreRule
+	roots          map[string]string
+}
+
+func newIgnorer(exclude []string, useIgnoreFiles bool) *ignorer {
+	cwd, _ := os.Getwd()
+	ig := &ignorer{
+		useIgnoreFiles: useIgnoreFiles,
+		rules:          map[string][]ignoreRule{},
+		roots:          map[string]string{},
+	}
+	for _, e := range exclude {
+		if rule, ok := parseIgnoreRule(e, cwd, "--exclude"); ok {
+			// Patterns without a slash match anywhere, not only below the working directory.
+			if !rule.anchored {
+				rule.base = ""
+			}
+			ig.exclude = append(ig.exclude, rule)
+		}
+	}
+	return ig
+}
+
+// ignored reports whether the path is ignored and by which file. Only the path itself is checked,
+// directories are skipped as a whole while walking.
+func (ig *ignorer) ignored(path string, isDir bool) (bool, string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, ""
+	}
+
+	if filepath.Base(abs) == ".git" && isDir {
+		return true, ".git"
+	}
+
+	var rules []ignoreRule
+	if ig.useIgnoreFiles {
+		for _, dir := range ig.dirsFromRoot(filepath.Dir(abs)) {
+			rules = append(rules, ig.rulesIn(dir)...)
+		}
+	}
+	return matchRules(append(rules, ig.exclude...), abs, isDir)
+}
+
+// excluded reports whether the path is excluded by the patterns given on the command line.
+// Files named explicitly are only checked against these, not against the ignore files.
+func (ig *ignorer) excluded(path string, isDir bool) (bool, string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, ""
+	}
+	return matchRules(ig.exclude, abs, isDir)
+}
+
+// matchRules applies the rules in order, so that later rules and negations override earlier ones.
+func matchRules(rules []ignoreRule, abs string, isDir bool) (bool, string) {
+	ignored, source := false, ""
+	for _, r := range rules {
+		if r.match(abs, isDir) {
+			ignored, source = !r.negate, r.source
+		}
+	}
+	return ignored, source
+}
+
+// dirsFromRoot returns the directories from the repository root containing .git down to dir.
+// Outside of a repository, the directories from the working directory are used.
+func (ig *ignorer) dirsFromRoot(dir string) []string {
+	root, ok := ig.roots[dir]
+	if !ok {
+		root = findRoot(dir)
+		ig.roots[dir] = root
+	}
+
+	var dirs []string
+	for d := dir; ; d = filepath.Dir(d) {
+		dirs = append([]string{d}, dirs...)
+		if d == root || filepath.Dir(d) == d {
+			break
+		}
+	}
+	return dirs
+}
+
+func findRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err == nil {
+		if rel, err := filepath.Rel(cwd, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return cwd
+		}
+	}
+	return dir
+}
+
+func (ig *ignorer) rulesIn(dir string) []ignoreRule {
+	if rules, ok := ig.rules[dir]; ok {
+		return rules
+	}
+
+	var rules []ignoreRule
+	for _, name := range ignoreFileNames {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text(), dir, name); ok {
+				rules = append(rules, rule)
+			}
+		}
+		_ = f.Close()
+	}
+
+	ig.rules[dir] = rules
+	return rules
+}
@@ -0,0 +1,136 @@
+package file
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"io"
+	"strings"
+)
+
+// Change - A file attached in the conversation that was modified or can no longer be read.
+type Change struct {
+	// Message is the attachment message.
+	Message conv.Message
+	// File holds the current contents. It is empty when Err is set.
+	File    FileContents
+	Err     error
+	Added   int
+	Removed int
+}
+
+// Changes checks the files attached in the HEAD chain against the files on disk. When the same part of a file was
+// attached several times, only the latest attachment is checked. Files that changed outside the attached part are not listed.
+// Attachments that do not record the file they were read from, such as the ones imported from Claude.ai, are not checked.
+func Changes(cv conv.Conversation) []Change {
+	chain := cv.MessagesFromHead()
+
+	latest := map[string]conv.Message{}
+	var keys []string
+	for _, m := range chain {
+		if m.Attachment == nil || m.Attachment.Kind != "" || (m.Attachment.Source == "" && m.Attachment.Hash == "") {
+			continue
+		}
+		key := m.Attachment.Key()
+		if _, ok := latest[key]; !ok {
+			keys = append(keys, key)
+		}
+		latest[key] = m
+	}
+
+	var changes []Change
+	for _, key := range keys {
+		m := latest[key]
+		f, err := Read(m.Attachment.SourcePath())
+		if err == nil {
+			f.Path = m.Attachment.Path
+			f, err = selectionOf(*m.Attachment).Apply(f)
+		}
+		if err != nil {
+			changes = append(changes, Change{Message: m, Err: err})
+			continue
+		}
+
+		old := conv.AttachmentContents(m)
+		if f.Hash == m.Attachment.Hash || f.Contents == old {
+			continue
+		}
+
+		added, removed := DiffStat(old, f.Contents)
+		changes = append(changes, Change{Message: m, File: f, Added: added, Removed: removed})
+	}
+	return changes
+}
+
+// Updates fits the changed files in the budgets and returns the new contents of their attachments.
+// Files that can no longer be read are left as they are.
+func Updates(changes []Change, limits config.AttachmentLimits) ([]conv.AttachmentUpdate, []Report, error) {
+	var files []FileContents
+	var attached []conv.Message
+	for _, c := range changes {
+		if c.Err == nil {
+			files = append(files, c.File)
+			attached = append(attached, c.Message)
+		}
+	}
+
+	kept, reports, err := ApplyLimits(files, limits)
+	if err != nil {
+		return nil, reports, err
+	}
+
+	var updates []conv.AttachmentUpdate
+	for _, f := range kept {
+		for i, file := range files {
+			if file.Label() == f.Label() {
+				a := f.Attachment()
+				if attached[i].Attachment.Source != "" {
+					a.Source = attached[i].Attachment.Source
+				}
+				updates = append(updates, conv.AttachmentUpdate{Sha1: attached[i].Sha1, Attachment: a, Contents: f.Contents})
+				break
+			}
+		}
+	}
+	return updates, reports, nil
+}
+
+// PrintChanges writes a line for each changed file with the number of lines added and removed.
+func PrintChanges(w io.Writer, changes []Change) {
+	for _, c := range changes {
+		if c.Err != nil {
+			_, _ = fmt.Fprintf(w, "  ! %s (%v)\n", c.Message.Attachment.Label(), c.Err)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "  M %s +%d -%d lines [%.6s]\n", c.Message.Attachment.Label(), c.Added, c.Removed, c.Message.Sha1)
+	}
+}
+
+// DiffStat counts the lines added and removed between the two texts. Moved lines are not counted.
+func DiffStat(old, new string) (int, int) {
+	counts := map[string]int{}
+	for _, line := range strings.Split(old, "\n") {
+		counts[line]++
+	}
+	for _, line := range strings.Split(new, "\n") {
+		counts[line]--
+	}
+
+	added, removed := 0, 0
+	for _, n := range counts {
+		if n > 0 {
+			removed += n
+		} else {
+			added -= n
+		}
+	}
+	return added, removed
+}
+
+// selectionOf returns the selection an attachment was made with. Symbols are looked up again, as they may have moved.
+func selectionOf(a conv.Attachment) Selection {
+	if a.Symbol != "" {
+		return Selection{Symbol: a.Symbol}
+	}
+	return Selection{Start: a.StartLine, End: a.EndLine}
+}
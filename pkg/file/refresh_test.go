@@ -0,0 +1,102 @@
+package file
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.go": "package a\n", "b.go": "package b\n", "c.go": "package c\n"})
+
+	cv := conv.NewConversation(config.InitialProfile())
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		f, err := Read(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cv.AppendAttachment(f.Attachment(), f.Contents)
+	}
+	cv.Append(conv.ChatRoleUser, "review these")
+
+	writeFiles(t, dir, map[string]string{"a.go": "package a\n\nfunc A() {}\n"})
+	if err := os.Remove(filepath.Join(dir, "c.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Changes(cv)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, but got %+v", changes)
+	}
+	if changes[0].Err != nil || changes[0].Added != 2 || changes[0].Removed != 0 {
+		t.Errorf("Expected a.go to be modified, but got %+v", changes[0])
+	}
+	if changes[1].Err == nil || changes[1].Message.Attachment.Path != filepath.Join(dir, "c.go") {
+		t.Errorf("Expected c.go to be missing, but got %+v", changes[1])
+	}
+
+	updates, _, err := Updates(changes, config.AttachmentLimits{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updates) != 1 || updates[0].Sha1 != changes[0].Message.Sha1 || updates[0].Contents != "package a\n\nfunc A() {}\n" {
+		t.Fatalf("Expected an update of a.go, but got %+v", updates)
+	}
+
+	if _, err := cv.ReplaceAttachments(updates); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changes := Changes(cv); len(changes) != 1 || changes[0].Err == nil {
+		t.Errorf("Expected only c.go to be left, but got %+v", changes)
+	}
+}
+
+func TestChangesOfSelections(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.go": goSource})
+
+	path := filepath.Join(dir, "a.go")
+	files, _, err := GetFileContents([]string{path + ":3", path + "#Config"}, Options{})
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Expected two parts of a.go, but got %+v, %v", files, err)
+	}
+	cv := conv.NewConversation(config.InitialProfile())
+	for _, f := range files {
+		cv.AppendAttachment(f.Attachment(), f.Contents)
+	}
+
+	source := strings.Replace(goSource, `import "fmt"`, `import "os"`, 1)
+	writeFiles(t, dir, map[string]string{"a.go": strings.Replace(source, "Name string", "Name string\n\tAge  int", 1)})
+
+	changes := Changes(cv)
+	if len(changes) != 2 {
+		t.Fatalf("Expected both parts to be checked, but got %+v", changes)
+	}
+	if changes[0].File.Contents != "import \"os\"\n" || !strings.Contains(changes[1].File.Contents, "Age  int") {
+		t.Errorf("Expected the line and the symbol to be refreshed, but got %q and %q", changes[0].File.Contents, changes[1].File.Contents)
+	}
+}
+
+func TestChangesSkipsImported(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.py": "print('local')\n"})
+
+	cv := conv.NewConversation(config.InitialProfile())
+	cv.AppendAttachment(conv.Attachment{Path: filepath.Join(dir, "main.py")}, "print('imported')\n")
+	cv.AppendAttachment(conv.Attachment{Path: filepath.Join(dir, "missing.py")}, "print('imported')\n")
+
+	if changes := Changes(cv); len(changes) != 0 {
+		t.Errorf("Expected attachments without a recorded file to be left alone, but got %+v", changes)
+	}
+}
+
+func TestDiffStat(t *testing.T) {
+	added, removed := DiffStat("a\nb\nc\n", "a\nc\nd\ne\n")
+	if added != 2 || removed != 1 {
+		t.Errorf("Expected +2 -1, but got +%d -%d", added, removed)
+	}
+}
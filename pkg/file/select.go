@@ -0,0 +1,295 @@
+package file
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Selection - The part of a file to attach, given as path:10-80 or path#Name. The zero value is the whole file.
+// Names may be qualified, such as Type.Method.
+type Selection struct {
+	Symbol string
+	// Start and End are 1-based and inclusive. End is 0 for the end of the file.
+	Start int
+	End   int
+}
+
+var (
+	lineRangePattern = regexp.MustCompile(`^(.+):(\d+)(?:-(\d*))?$`)
+	symbolPattern    = regexp.MustCompile(`^(.+)#([\pL_$][\pL\pN_$.]*)$`)
+)
+
+// ParseSelection splits a line range or a symbol off the argument. Arguments naming an existing file are
+// taken as they are.
+func ParseSelection(arg string) (string, Selection, error) {
+	if _, err := os.Stat(arg); err == nil {
+		return arg, Selection{}, nil
+	}
+
+	if m := symbolPattern.FindStringSubmatch(arg); m != nil {
+		return m[1], Selection{Symbol: m[2]}, nil
+	}
+
+	if m := lineRangePattern.FindStringSubmatch(arg); m != nil {
+		start, _ := strconv.Atoi(m[2])
+		end := start
+		if strings.Contains(arg[len(m[1])+1:], "-") {
+			end = 0
+			if m[3] != "" {
+				end, _ = strconv.Atoi(m[3])
+			}
+		}
+		if start < 1 || (end != 0 && end < start) {
+			return "", Selection{}, fmt.Errorf("invalid line range: %s", arg[len(m[1])+1:])
+		}
+		return m[1], Selection{Start: start, End: end}, nil
+	}
+
+	return arg, Selection{}, nil
+}
+
+// IsZero reports whether the selection is the whole file.
+func (s Selection) IsZero() bool {
+	return s.Symbol == "" && s.Start == 0
+}
+
+func (s Selection) String() string {
+	switch {
+	case s.Symbol != "":
+		return "#" + s.Symbol
+	case s.Start == 0:
+		return ""
+	case s.End == s.Start:
+		return fmt.Sprintf(":%d", s.Start)
+	case s.End == 0:
+		return fmt.Sprintf(":%d-", s.Start)
+	}
+	return fmt.Sprintf(":%d-%d", s.Start, s.End)
+}
+
+// Apply narrows the contents of the file down to the selection. Symbols are found with go/ast in Go files,
+// and by looking for a definition and the block that follows in other files.
+func (s Selection) Apply(f FileContents) (FileContents, error) {
+	if s.IsZero() {
+		return f, nil
+	}
+
+	start, end := s.Start, s.End
+	if s.Symbol != "" {
+		var err error
+		if strings.HasSuffix(f.Path, ".go") {
+			start, end, err = goSymbolLines(f.Path, f.Contents, s.Symbol)
+		} else {
+			start, end, err = symbolLines(f.Contents, s.Symbol)
+		}
+		if err != nil {
+			return FileContents{}, err
+		}
+	}
+
+	lines := strings.SplitAfter(f.Contents, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if start > len(lines) {
+		return FileContents{}, fmt.Errorf("line %d is beyond the end of the file (%d lines)", start, len(lines))
+	}
+	if end == 0 || end > len(lines) {
+		end = len(lines)
+	}
+
+	f.Contents = strings.Join(lines[start-1:end], "")
+	f.Length = len(f.Contents)
+	f.Symbol = s.Symbol
+	f.StartLine = start
+	f.EndLine = end
+	return f, nil
+}
+
+// goSymbolLines returns the lines of a top-level declaration including its doc comment.
+// Methods are given as Type.Method.
+func goSymbolLines(path string, src string, symbol string) (int, int, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	typeName, name, isMethod := strings.Cut(symbol, ".")
+	if !isMethod {
+		name = typeName
+	}
+
+	lines := func(doc *ast.CommentGroup, node ast.Node) (int, int, error) {
+		pos := node.Pos()
+		if doc != nil {
+			pos = doc.Pos()
+		}
+		return fset.Position(pos).Line, fset.Position(node.End()).Line, nil
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Name.Name != name || (d.Recv != nil) != isMethod {
+				continue
+			}
+			if isMethod && receiverType(d.Recv) != typeName {
+				continue
+			}
+			return lines(d.Doc, d)
+		case *ast.GenDecl:
+			if isMethod {
+				continue
+			}
+			for _, spec := range d.Specs {
+				var names []*ast.Ident
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					names = []*ast.Ident{sp.Name}
+				case *ast.ValueSpec:
+					names = sp.Names
+				}
+				for _, ident := range names {
+					if ident.Name != name {
+						continue
+					}
+					if len(d.Specs) == 1 {
+						return lines(d.Doc, d)
+					}
+					return lines(nil, spec)
+				}
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("symbol not found: %s", symbol)
+}
+
+func receiverType(recv *ast.FieldList) string {
+	if len(recv.List) == 0 {
+		return ""
+	}
+
+	expr := recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// symbolLines finds a definition such as `def name`, `function name` or `class name`, and the block that follows
+// it, by braces or by indentation. Decorators and comments directly above are included.
+// Qualified names are looked up inside the block of the outer name.
+func symbolLines(src string, symbol string) (int, int, error) {
+	lines := strings.Split(src, "\n")
+	from, to := 0, len(lines)
+
+	start, end := 0, 0
+	for _, name := range strings.Split(symbol, ".") {
+		definition := regexp.MustCompile(`(?:^|[\s(])(?:def|function|func|fn|class|interface|struct|enum|trait|impl|type|module|sub|const|let|var)\s+` + regexp.QuoteMeta(name) + `\b`)
+		assignment := regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)?\s*` + regexp.QuoteMeta(name) + `\s*[:=]\s*(?:async\s*)?(?:function\b|\()`)
+
+		found := -1
+		for i := from; i < to; i++ {
+			if definition.MatchString(lines[i]) || assignment.MatchString(lines[i]) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return 0, 0, fmt.Errorf("symbol not found: %s", symbol)
+		}
+
+		start, end = found, blockEnd(lines, found)
+		from, to = start+1, end+1
+	}
+
+	for start > 0 {
+		above := strings.TrimSpace(lines[start-1])
+		if !strings.HasPrefix(above, "@") && !isComment(above) {
+			break
+		}
+		start--
+	}
+	return start + 1, end + 1, nil
+}
+
+// blockEnd returns the last line of the block starting at the line, by matching braces when the definition
+// opens one, and by indentation otherwise.
+func blockEnd(lines []string, start int) int {
+	if !strings.HasSuffix(strings.TrimSpace(lines[start]), ":") {
+		if end, ok := braceEnd(lines, start); ok {
+			return end
+		}
+	}
+
+	indent := indentOf(lines[start])
+	end := start
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if indentOf(lines[i]) <= indent {
+			break
+		}
+		end = i
+	}
+	return end
+}
+
+// braceEnd returns the line closing the brace opened on the line or the next one. A definition ending with
+// a semicolon before any brace is a single statement.
+func braceEnd(lines []string, start int) (int, bool) {
+	depth := 0
+	opened := false
+	for i := start; i < len(lines); i++ {
+		if i > start+1 && !opened {
+			return 0, false
+		}
+		for _, r := range lines[i] {
+			switch r {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			}
+		}
+		if opened && depth <= 0 {
+			return i, true
+		}
+		if !opened && strings.HasSuffix(strings.TrimSpace(lines[i]), ";") {
+			return i, true
+		}
+	}
+	return len(lines) - 1, opened
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func isComment(line string) bool {
+	for _, prefix := range []string{"//", "#", "/*", "*", "--", ";"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
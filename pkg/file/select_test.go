@@ -0,0 +1,138 @@
+package file
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		arg      string
+		path     string
+		expected Selection
+	}{
+		{arg: "main.go", path: "main.go"},
+		{arg: "main.go:10-80", path: "main.go", expected: Selection{Start: 10, End: 80}},
+		{arg: "main.go:10", path: "main.go", expected: Selection{Start: 10, End: 10}},
+		{arg: "main.go:10-", path: "main.go", expected: Selection{Start: 10}},
+		{arg: "main.go#main", path: "main.go", expected: Selection{Symbol: "main"}},
+		{arg: "pkg/**/*.go#Config.Validate", path: "pkg/**/*.go", expected: Selection{Symbol: "Config.Validate"}},
+		{arg: `C:\src\main.go`, path: `C:\src\main.go`},
+	}
+
+	for _, tt := range tests {
+		path, sel, err := ParseSelection(tt.arg)
+		if err != nil || path != tt.path || sel != tt.expected {
+			t.Errorf("ParseSelection(%q) = %q, %+v, %v, expected %q, %+v", tt.arg, path, sel, err, tt.path, tt.expected)
+		}
+	}
+
+	if _, _, err := ParseSelection("main.go:80-10"); err == nil {
+		t.Errorf("Expected an error for a reversed range")
+	}
+}
+
+const goSource = `package a
+
+import "fmt"
+
+// Config holds the settings.
+type Config struct {
+	Name string
+}
+
+// Validate checks the settings.
+func (c *Config) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("no name")
+	}
+	return nil
+}
+
+func Validate() {}
+
+var (
+	first  = 1
+	second = 2
+)
+`
+
+func TestSelectionApplyGo(t *testing.T) {
+	f := FileContents{Path: "a.go", Contents: goSource}
+
+	tests := map[string][2]int{
+		"Config":          {5, 8},
+		"Config.Validate": {10, 16},
+		"Validate":        {18, 18},
+		"second":          {22, 22},
+	}
+	for symbol, lines := range tests {
+		selected, err := Selection{Symbol: symbol}.Apply(f)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", symbol, err)
+			continue
+		}
+		if selected.StartLine != lines[0] || selected.EndLine != lines[1] || selected.Symbol != symbol {
+			t.Errorf("%s: expected lines %v, but got %d-%d", symbol, lines, selected.StartLine, selected.EndLine)
+		}
+	}
+
+	if _, err := (Selection{Symbol: "Missing"}).Apply(f); err == nil {
+		t.Errorf("Expected an error for a missing symbol")
+	}
+
+	selected, err := Selection{Start: 18, End: 100}.Apply(f)
+	if err != nil || selected.Contents != "func Validate() {}\n\nvar (\n\tfirst  = 1\n\tsecond = 2\n)\n" || selected.EndLine != 23 {
+		t.Errorf("Expected the range to stop at the end of the file, but got %q, %v", selected.Contents, err)
+	}
+}
+
+func TestSelectionApplyHeuristic(t *testing.T) {
+	python := "import os\n\n\nclass Greeter:\n    @staticmethod\n    def hello(name):\n        return {\n            'name': name,\n        }\n\n    def bye(self):\n        pass\n\n\ndef main():\n    Greeter.hello('a')\n"
+	js := "const a = 1;\n\n// add returns the sum.\nexport function add(x, y) {\n  if (x) {\n    return x + y;\n  }\n}\n\nconst sub = (x, y) => {\n  return x - y;\n};\n"
+
+	tests := []struct {
+		path     string
+		contents string
+		symbol   string
+		expected string
+	}{
+		{"a.py", python, "Greeter.hello", "    @staticmethod\n    def hello(name):\n        return {\n            'name': name,\n        }\n"},
+		{"a.py", python, "main", "def main():\n    Greeter.hello('a')\n"},
+		{"a.js", js, "add", "// add returns the sum.\nexport function add(x, y) {\n  if (x) {\n    return x + y;\n  }\n}\n"},
+		{"a.js", js, "sub", "const sub = (x, y) => {\n  return x - y;\n};\n"},
+	}
+	for _, tt := range tests {
+		selected, err := Selection{Symbol: tt.symbol}.Apply(FileContents{Path: tt.path, Contents: tt.contents})
+		if err != nil || selected.Contents != tt.expected {
+			t.Errorf("%s#%s: expected %q, but got %q, %v", tt.path, tt.symbol, tt.expected, selected.Contents, err)
+		}
+	}
+}
+
+func TestGetFileContentsWithSelection(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.go": goSource, "b.go": "package a\n"})
+
+	contents, skipped, _ := GetFileContents([]string{filepath.Join(dir, "a.go") + ":3", filepath.Join(dir, "*.go") + "#Config"}, Options{})
+	if len(contents) != 2 || contents[0].Contents != "import \"fmt\"\n" || !strings.HasPrefix(contents[1].Contents, "// Config holds") {
+		t.Fatalf("Expected line 3 and Config of a.go, but got %+v", contents)
+	}
+	if contents[1].Label() != filepath.Join(dir, "a.go")+"#Config" {
+		t.Errorf("Unexpected label: %s", contents[1].Label())
+	}
+	if len(skipped) != 1 || !strings.Contains(skipped[0].Reason, "symbol not found") {
+		t.Errorf("Expected b.go to be skipped, but got %+v", skipped)
+	}
+}
+
+func TestGetFileContentsInvalidSelection(t *testing.T) {
+	_, skipped, err := GetFileContents([]string{"main.go:80-10"}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(skipped) != 1 || skipped[0].Path != "main.go:80-10" {
+		t.Errorf("Expected the argument to be reported, but got %+v", skipped)
+	}
+}
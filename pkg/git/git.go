@@ -0,0 +1,137 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/kznrluk/aski/pkg/file"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNoChanges is returned when a diff is empty.
+var ErrNoChanges = errors.New("no changes")
+
+// Diff returns the unified diff for the revision as git diff takes it, such as HEAD for the uncommitted changes
+// or main...HEAD for the changes of a branch, as contents to attach.
+func Diff(rev string) (file.FileContents, error) {
+	return diff([]string{"diff", rev})
+}
+
+// IsRevision reports whether git takes the argument as a revision or a range of revisions, such as main...HEAD,
+// rather than as a path or text.
+func IsRevision(arg string) bool {
+	if arg == "" || strings.HasPrefix(arg, "-") {
+		return false
+	}
+	out, err := run("rev-parse", "--revs-only", arg)
+	return err == nil && strings.TrimSpace(out) != ""
+}
+
+// StagedDiff returns the unified diff of the changes staged for the next commit as contents to attach.
+func StagedDiff() (file.FileContents, error) {
+	return diff([]string{"diff", "--cached"})
+}
+
+func diff(args []string) (file.FileContents, error) {
+	out, err := run(args...)
+	if err != nil {
+		return file.FileContents{}, err
+	}
+	if strings.TrimSpace(out) == "" {
+		return file.FileContents{}, fmt.Errorf("git %s: %w", strings.Join(args, " "), ErrNoChanges)
+	}
+
+	return file.FileContents{
+		Name:     "diff",
+		Path:     "git " + strings.Join(args, " "),
+		Contents: out,
+		Length:   len(out),
+		Kind:     conv.AttachmentKindGitDiff,
+	}, nil
+}
+
+// RepoMap returns a tree of the files tracked or not ignored by git in the repository, with their sizes,
+// as contents to attach.
+func RepoMap() (file.FileContents, error) {
+	root, err := run("rev-parse", "--show-toplevel")
+	if err != nil {
+		return file.FileContents{}, err
+	}
+	root = strings.TrimSpace(root)
+
+	out, err := run("-C", root, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return file.FileContents{}, err
+	}
+
+	var files []string
+	for _, f := range strings.Split(out, "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+
+	var b strings.Builder
+	b.WriteString(filepath.Base(root) + "/\n")
+	printed := map[string]bool{}
+	for _, f := range files {
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(f)))
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		dirs := strings.Split(path.Dir(f), "/")
+		if dirs[0] == "." {
+			dirs = nil
+		}
+		for i := range dirs {
+			dir := strings.Join(dirs[:i+1], "/")
+			if !printed[dir] {
+				printed[dir] = true
+				b.WriteString(fmt.Sprintf("%s%s/\n", strings.Repeat("  ", i+1), dirs[i]))
+			}
+		}
+		b.WriteString(fmt.Sprintf("%s%s %s\n", strings.Repeat("  ", len(dirs)+1), path.Base(f), formatSize(info.Size())))
+	}
+
+	contents := b.String()
+	return file.FileContents{
+		Name:     "repo-map",
+		Path:     "git ls-files",
+		Contents: contents,
+		Length:   len(contents),
+		Kind:     conv.AttachmentKindRepoMap,
+	}, nil
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%dB", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1fKB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%.1fMB", float64(size)/1024/1024)
+}
+
+func run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,138 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "test"},
+		{"config", "user.email", "test@example.com"},
+	} {
+		if _, err := run(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func write(t *testing.T, dir string, name string, content string) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffs(t *testing.T) {
+	dir := gitRepo(t)
+	write(t, dir, "a.txt", "one\n")
+	if _, err := run("add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("commit", "-qm", "init"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Diff("HEAD"); !errors.Is(err, ErrNoChanges) {
+		t.Errorf("Expected no changes, but got %v", err)
+	}
+
+	write(t, dir, "a.txt", "one\ntwo\n")
+	if _, err := run("add", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	write(t, dir, "a.txt", "one\ntwo\nthree\n")
+
+	staged, err := StagedDiff()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(staged.Contents, "+two") || strings.Contains(staged.Contents, "+three") || staged.Path != "git diff --cached" {
+		t.Errorf("Expected only the staged change, but got %s: %q", staged.Path, staged.Contents)
+	}
+
+	all, err := Diff("HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(all.Contents, "+two") || !strings.Contains(all.Contents, "+three") {
+		t.Errorf("Expected every uncommitted change, but got %q", all.Contents)
+	}
+
+	if _, err := Diff("no-such-rev"); err == nil || errors.Is(err, ErrNoChanges) {
+		t.Errorf("Expected an error for an unknown revision, but got %v", err)
+	}
+}
+
+func TestIsRevision(t *testing.T) {
+	dir := gitRepo(t)
+	write(t, dir, "a.txt", "one\n")
+	if _, err := run("add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("commit", "-qm", "init"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("branch", "feature"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, arg := range []string{"HEAD", "feature", "HEAD...feature"} {
+		if !IsRevision(arg) {
+			t.Errorf("Expected %q to be a revision", arg)
+		}
+	}
+	for _, arg := range []string{"", "a.txt", "Is this ready to commit?", "--cached"} {
+		if IsRevision(arg) {
+			t.Errorf("Expected %q not to be a revision", arg)
+		}
+	}
+}
+
+func TestRepoMap(t *testing.T) {
+	dir := gitRepo(t)
+	write(t, dir, ".gitignore", "*.log\n")
+	write(t, dir, "main.go", "package main\n")
+	write(t, dir, "pkg/a/a.go", strings.Repeat("x", 2048))
+	write(t, dir, "pkg/b.go", "package pkg\n")
+	write(t, dir, "debug.log", "log")
+
+	m, err := RepoMap()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := filepath.Base(dir) + "/\n" +
+		"  .gitignore 6B\n" +
+		"  main.go 13B\n" +
+		"  pkg/\n" +
+		"    a/\n" +
+		"      a.go 2.0KB\n" +
+		"    b.go 12B\n"
+	if m.Contents != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, m.Contents)
+	}
+}
@@ -0,0 +1,303 @@
+package history
+
+import (
+	"bytes"
+	"errors"
+	"filippo.io/age"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// PassphraseEnv is read for the passphrase of the history key before prompting.
+	PassphraseEnv  = "ASKI_PASSPHRASE"
+	historyKeyFile = "history-key.age"
+	ageHeader      = "age-encryption.org/"
+)
+
+// PromptPassphrase asks the user for the passphrase of the history key. confirm is set when a new key is created.
+// It is set by the CLI, and passphrases are only read from PassphraseEnv when it is nil.
+var PromptPassphrase func(confirm bool) (string, error)
+
+var errNoHistoryKey = errors.New("no key to decrypt the history")
+
+type keyring struct {
+	identities []age.Identity
+	recipient  age.Recipient
+}
+
+var (
+	encryptionOnce sync.Once
+	encryption     config.Encryption
+
+	keysMu  sync.Mutex
+	keys    *keyring
+	keysErr error
+)
+
+func encryptionConfig() config.Encryption {
+	encryptionOnce.Do(func() {
+		if cfg, err := config.GetConfig(); err == nil {
+			encryption = cfg.Encryption
+		}
+	})
+	return encryption
+}
+
+// EncryptionEnabled reports whether saved conversations are encrypted.
+func EncryptionEnabled() bool {
+	return encryptionConfig().Enabled
+}
+
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageHeader))
+}
+
+// readFile reads the file, decrypting it if it is encrypted.
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !isEncrypted(data) {
+		return data, err
+	}
+
+	k, err := loadKeyring(false)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), k.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %v", filepath.Base(path), err)
+	}
+	return io.ReadAll(r)
+}
+
+// writeFile writes the file, encrypting it when encryption is enabled.
+func writeFile(path string, data []byte) error {
+	if !EncryptionEnabled() {
+		return os.WriteFile(path, data, 0600)
+	}
+
+	var b bytes.Buffer
+	w, err := encryptTo(&b)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(), 0600)
+}
+
+// encryptTo returns a writer encrypting to the history key. It must be closed to flush the encrypted data.
+func encryptTo(w io.Writer) (io.WriteCloser, error) {
+	k, err := loadKeyring(true)
+	if err != nil {
+		return nil, err
+	}
+	return age.Encrypt(w, k.recipient)
+}
+
+// loadKeyring loads the key once per process. A new passphrase protected key is created when create is set
+// and there is no key yet. Failures are kept so that a wrong passphrase is not asked for every file.
+func loadKeyring(create bool) (*keyring, error) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	if keys != nil || keysErr != nil {
+		return keys, keysErr
+	}
+
+	var k *keyring
+	var err error
+	if keyFile := encryptionConfig().KeyFile; keyFile != "" {
+		k, err = loadKeyFile(keyFile)
+	} else {
+		k, err = loadPassphraseKey(create)
+	}
+	if errors.Is(err, errNoHistoryKey) {
+		return nil, err
+	}
+
+	keys, keysErr = k, err
+	return keys, keysErr
+}
+
+func loadKeyFile(path string) (*keyring, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := config.GetHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, rest)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key file: %v", err)
+	}
+	defer f.Close()
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %v", path, err)
+	}
+
+	for _, identity := range identities {
+		if x, ok := identity.(*age.X25519Identity); ok {
+			return &keyring{identities: identities, recipient: x.Recipient()}, nil
+		}
+	}
+	return nil, fmt.Errorf("no X25519 identity in key file %s", path)
+}
+
+// loadPassphraseKey decrypts the generated key with the passphrase. The key is stored encrypted with the passphrase
+// so that scrypt runs once per process instead of once per file.
+func loadPassphraseKey(create bool) (*keyring, error) {
+	path := filepath.Join(config.MustGetAskiDir(), historyKeyFile)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if !create {
+			return nil, fmt.Errorf("%w: %s does not exist, set Encryption.KeyFile in config.yaml", errNoHistoryKey, path)
+		}
+		return createPassphraseKey(path)
+	} else if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+
+	scrypt, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), scrypt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt history key, wrong passphrase?: %v", err)
+	}
+
+	key, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := age.ParseX25519Identity(strings.TrimSpace(string(key)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse history key: %v", err)
+	}
+	return &keyring{identities: []age.Identity{identity}, recipient: identity.Recipient()}, nil
+}
+
+func createPassphraseKey(path string) (*keyring, error) {
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, err
+	}
+
+	scrypt, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	w, err := age.Encrypt(&b, scrypt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, identity.String()+"\n"); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+	return &keyring{identities: []age.Identity{identity}, recipient: identity.Recipient()}, nil
+}
+
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if PromptPassphrase == nil {
+		return "", fmt.Errorf("history is encrypted, set the passphrase in %s", PassphraseEnv)
+	}
+
+	passphrase, err := PromptPassphrase(confirm)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("empty passphrase")
+	}
+	return passphrase, nil
+}
+
+// EncryptAll encrypts the conversations and indexes in the history directory that are not encrypted yet,
+// keeping their modification times. It returns the number of files encrypted.
+func EncryptAll() (int, error) {
+	if !EncryptionEnabled() {
+		return 0, errors.New("encryption is not enabled, set Encryption.Enabled in config.yaml")
+	}
+
+	files, err := Files()
+	if err != nil {
+		return 0, err
+	}
+
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, filepath.Join(config.MustGetHistoryDir(), file))
+	}
+	paths = append(paths, historyIndexPath(), searchIndexPath())
+
+	count := 0
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return count, err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return count, err
+		}
+		if isEncrypted(data) {
+			continue
+		}
+
+		if err := writeFile(path, data); err != nil {
+			return count, fmt.Errorf("failed to encrypt %s: %v", filepath.Base(path), err)
+		}
+		if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
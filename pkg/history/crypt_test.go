@@ -0,0 +1,135 @@
+package history
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"filippo.io/age"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptedSaveAndLoad(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(home, "key.txt")
+	if err := os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptionOnce.Do(func() {})
+	encryption = config.Encryption{Enabled: true, KeyFile: keyFile}
+	t.Cleanup(func() {
+		encryption = config.Encryption{}
+		keys, keysErr = nil, nil
+	})
+
+	cv := conv.NewConversation(config.InitialProfile())
+	cv.Append(conv.ChatRoleUser, "secret source code")
+	if err := SaveAs(cv, "20240301-120000.yaml"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, path := range []string{filepath.Join(config.MustGetHistoryDir(), "20240301-120000.yaml"), historyIndexPath(), searchIndexPath()} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isEncrypted(data) {
+			t.Errorf("Expected %s to be encrypted", filepath.Base(path))
+		}
+	}
+
+	loaded, err := Load("20240301-120000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded.Last().Content != "secret source code" {
+		t.Errorf("Expected the decrypted message, but got %q", loaded.Last().Content)
+	}
+
+	matches, err := Search(SearchOptions{Query: "secret"})
+	if err != nil || len(matches) != 1 {
+		t.Errorf("Expected 1 match from the encrypted index, but got %d, %v", len(matches), err)
+	}
+}
+
+func TestEncryptedArchive(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(home, "key.txt")
+	if err := os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptionOnce.Do(func() {})
+	encryption = config.Encryption{Enabled: true, KeyFile: keyFile}
+	t.Cleanup(func() {
+		encryption = config.Encryption{}
+		keys, keysErr = nil, nil
+	})
+
+	cv := conv.NewConversation(config.InitialProfile())
+	cv.Append(conv.ChatRoleUser, "secret source code")
+	if err := SaveAs(cv, "20240301-120000.yaml"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, err := Find("20240301-120000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := ArchiveFilename(time.Date(2024, 3, 2, 0, 0, 0, 0, time.Local))
+	if err := Archive(path, []Summary{s}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := age.Decrypt(f, identity)
+	if err != nil {
+		t.Fatalf("Expected the archive to be encrypted with the key, but got %v", err)
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			t.Fatal("Expected the conversation in the archive")
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name != "history/20240301-120000.yaml" {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "secret source code") {
+			t.Errorf("Expected the conversation to be decrypted in the archive, but got %q", data)
+		}
+		return
+	}
+}
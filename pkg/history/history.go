@@ -0,0 +1,132 @@
+package history
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const timeFormat = "20060102-150405"
+
+// Load reads the conversation saved in the history directory with the given id.
+func Load(id string) (conv.Conversation, error) {
+	historyDir := config.MustGetHistoryDir()
+	if _, err := os.Stat(historyDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("history directory does not exist")
+	}
+
+	return LoadFile(filepath.Join(historyDir, strings.TrimSuffix(id, ".yaml")+".yaml"))
+}
+
+// LoadFile reads the conversation saved at the path.
+func LoadFile(path string) (conv.Conversation, error) {
+	bytes, err := readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %v", path, err)
+	}
+
+	cv, err := conv.FromYAML(bytes, filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing file %s: %v", path, err)
+	}
+
+	return cv, nil
+}
+
+// Save writes the conversation to the history directory and returns its file name.
+// Conversations without a file name are named after the current time.
+func Save(cv conv.Conversation) (string, error) {
+	if len(cv.GetMessages()) == 0 {
+		return "", nil
+	}
+
+	filename := cv.GetFilename()
+	if filename == "" {
+		filename = fmt.Sprintf("%s.yaml", time.Now().Format(timeFormat))
+	}
+
+	return filename, SaveAs(cv, filename)
+}
+
+// SaveAs writes the conversation to the history directory with the given file name.
+func SaveAs(cv conv.Conversation, filename string) error {
+	historyDir := config.MustGetHistoryDir()
+	if err := os.MkdirAll(historyDir, 0700); err != nil {
+		return err
+	}
+
+	yamlString, err := cv.ToYAML()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(filepath.Join(historyDir, filename), yamlString); err != nil {
+		return err
+	}
+
+	if err := updateHistoryIndex(filename, cv); err != nil {
+		slog.Warn(fmt.Sprintf("failed to update history index: %v", err))
+	}
+	if err := updateSearchIndex(filename, cv); err != nil {
+		slog.Warn(fmt.Sprintf("failed to update search index: %v", err))
+	}
+	return nil
+}
+
+// NewFilename returns an unused file name in the history directory for a conversation started at t.
+func NewFilename(t time.Time) string {
+	historyDir := config.MustGetHistoryDir()
+	base := t.Format(timeFormat)
+
+	filename := base + ".yaml"
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(historyDir, filename)); os.IsNotExist(err) {
+			return filename
+		}
+		filename = fmt.Sprintf("%s-%d.yaml", base, i)
+	}
+}
+
+// Files returns the file names of the conversations in the history directory.
+func Files() ([]string, error) {
+	files, err := os.ReadDir(config.MustGetHistoryDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".yaml") {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+// Sources returns the file names of imported conversations keyed by their source.
+func Sources() (map[string]string, error) {
+	files, err := Files()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]string{}
+	for _, file := range files {
+		cv, err := Load(file)
+		if err != nil {
+			continue
+		}
+		if cv.GetSource() != "" {
+			sources[cv.GetSource()] = file
+		}
+	}
+
+	return sources, nil
+}
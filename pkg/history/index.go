@@ -0,0 +1,244 @@
+package history
+
+import (
+	"encoding/json"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const historyIndexFile = "history-index.json"
+
+// Summary - Metadata of a saved conversation kept in the history index.
+type Summary struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	Preview   string    `json:"preview,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Profile   string    `json:"profile,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Messages  int       `json:"messages"`
+	Tags      []string  `json:"tags,omitempty"`
+	Tokens    int       `json:"tokens"`
+}
+
+// ListOptions - Filters for List. Since and Until apply to the update time, and Profile matches case-insensitively.
+type ListOptions struct {
+	Since   time.Time
+	Until   time.Time
+	Profile string
+	Limit   int
+}
+
+// historyIndex keeps the metadata of every conversation so that listing does not parse every file.
+type historyIndex struct {
+	// ModTimes holds the modification time of each file when it was indexed.
+	ModTimes  map[string]int64   `json:"mod_times"`
+	Summaries map[string]Summary `json:"summaries"`
+	// Failed holds the files that could not be read, so that they are skipped until they change.
+	Failed map[string]fileStamp `json:"failed,omitempty"`
+}
+
+// fileStamp - The modification time and size of a file, to tell whether it changed.
+type fileStamp struct {
+	ModTime int64 `json:"mod_time"`
+	Size    int64 `json:"size"`
+}
+
+func stampOf(info os.FileInfo) fileStamp {
+	return fileStamp{ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+}
+
+// List returns the conversations in the history directory matching the options, most recently updated first.
+func List(opts ListOptions) ([]Summary, error) {
+	idx, err := refreshedHistoryIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []Summary
+	for _, s := range idx.Summaries {
+		if !opts.Since.IsZero() && s.UpdatedAt.Before(opts.Since) {
+			continue
+		}
+		if !opts.Until.IsZero() && s.UpdatedAt.After(opts.Until) {
+			continue
+		}
+		if opts.Profile != "" && !strings.EqualFold(s.Profile, opts.Profile) {
+			continue
+		}
+		summaries = append(summaries, s)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].UpdatedAt.Equal(summaries[j].UpdatedAt) {
+			return summaries[i].ID > summaries[j].ID
+		}
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+
+	if opts.Limit > 0 && len(summaries) > opts.Limit {
+		summaries = summaries[:opts.Limit]
+	}
+	return summaries, nil
+}
+
+// Summarize returns the metadata of the conversation saved in the file.
+func Summarize(file string, cv conv.Conversation, modTime time.Time) Summary {
+	messages := cv.GetMessages()
+
+	s := Summary{
+		ID:        strings.TrimSuffix(file, ".yaml"),
+		Title:     cv.GetTitle(),
+		Preview:   Preview(cv),
+		UpdatedAt: modTime,
+		Profile:   cv.GetProfile().ProfileName,
+		Model:     cv.GetProfile().Model,
+		Messages:  len(messages),
+		Tokens:    conv.EstimateTokens(messages),
+	}
+
+	seen := map[string]bool{}
+	for _, m := range messages {
+		if !m.CreatedAt.IsZero() && (s.CreatedAt.IsZero() || m.CreatedAt.Before(s.CreatedAt)) {
+			s.CreatedAt = m.CreatedAt
+		}
+		if m.Role == conv.ChatRoleAssistant && m.Model != "" {
+			s.Model = m.Model
+		}
+		for _, tag := range m.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				s.Tags = append(s.Tags, tag)
+			}
+		}
+	}
+
+	if s.CreatedAt.IsZero() {
+		if t, err := time.ParseInLocation(timeFormat, s.ID[:min(len(s.ID), len(timeFormat))], time.Local); err == nil {
+			s.CreatedAt = t
+		} else {
+			s.CreatedAt = modTime
+		}
+	}
+	return s
+}
+
+func historyIndexPath() string {
+	return filepath.Join(config.MustGetAskiDir(), historyIndexFile)
+}
+
+func loadHistoryIndex() *historyIndex {
+	idx := &historyIndex{ModTimes: map[string]int64{}, Summaries: map[string]Summary{}, Failed: map[string]fileStamp{}}
+
+	data, err := readFile(historyIndexPath())
+	if err != nil {
+		return idx
+	}
+
+	if err := json.Unmarshal(data, idx); err != nil || idx.ModTimes == nil || idx.Summaries == nil {
+		return &historyIndex{ModTimes: map[string]int64{}, Summaries: map[string]Summary{}, Failed: map[string]fileStamp{}}
+	}
+	if idx.Failed == nil {
+		idx.Failed = map[string]fileStamp{}
+	}
+	return idx
+}
+
+// refreshedHistoryIndex loads the index and re-reads only the files added or modified since they were indexed.
+// Files that cannot be read are not listed, and are not read again until they change.
+func refreshedHistoryIndex() (*historyIndex, error) {
+	idx := loadHistoryIndex()
+
+	files, err := os.ReadDir(config.MustGetHistoryDir())
+	if os.IsNotExist(err) {
+		return idx, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	exists := map[string]bool{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".yaml") {
+			continue
+		}
+		exists[file.Name()] = true
+
+		info, err := file.Info()
+		if err != nil || idx.ModTimes[file.Name()] == info.ModTime().UnixNano() {
+			continue
+		}
+		if stamp, ok := idx.Failed[file.Name()]; ok && stamp == stampOf(info) {
+			continue
+		}
+
+		changed = true
+		cv, err := Load(file.Name())
+		if err != nil {
+			idx.remove(file.Name())
+			idx.Failed[file.Name()] = stampOf(info)
+			continue
+		}
+		idx.update(file.Name(), cv, info.ModTime())
+	}
+
+	for file := range idx.ModTimes {
+		if !exists[file] {
+			changed = true
+			idx.remove(file)
+		}
+	}
+	for file := range idx.Failed {
+		if !exists[file] {
+			changed = true
+			idx.remove(file)
+		}
+	}
+
+	if !changed {
+		return idx, nil
+	}
+	return idx, idx.save()
+}
+
+func (idx *historyIndex) save() error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(config.MustGetAskiDir(), 0700); err != nil {
+		return err
+	}
+	return writeFile(historyIndexPath(), data)
+}
+
+func (idx *historyIndex) update(file string, cv conv.Conversation, modTime time.Time) {
+	delete(idx.Failed, file)
+	idx.ModTimes[file] = modTime.UnixNano()
+	idx.Summaries[file] = Summarize(file, cv, modTime)
+}
+
+func (idx *historyIndex) remove(file string) {
+	delete(idx.ModTimes, file)
+	delete(idx.Summaries, file)
+	delete(idx.Failed, file)
+}
+
+// updateHistoryIndex records the metadata of a conversation that has just been saved.
+func updateHistoryIndex(file string, cv conv.Conversation) error {
+	info, err := os.Stat(filepath.Join(config.MustGetHistoryDir(), file))
+	if err != nil {
+		return err
+	}
+
+	idx := loadHistoryIndex()
+	idx.update(file, cv, info.ModTime())
+	return idx.save()
+}
@@ -0,0 +1,171 @@
+package history
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// saveAt saves a conversation starting with the message into a temporary history directory and sets its
+// modification time.
+func saveAt(t *testing.T, id string, profile config.Profile, message string, modTime time.Time) {
+	t.Helper()
+	cv := conv.NewConversation(profile)
+	cv.Append(conv.ChatRoleUser, message)
+	if err := SaveAs(cv, id+".yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(config.MustGetHistoryDir(), id+".yaml"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ids(summaries []Summary) []string {
+	var result []string
+	for _, s := range summaries {
+		result = append(result, s.ID)
+	}
+	return result
+}
+
+func TestSummarize(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	messages := []conv.Message{
+		{Sha1: "a", ParentSha1: "ROOT", Role: conv.ChatRoleUser, Content: "package a", Attachment: &conv.Attachment{Path: "a.go"}},
+		{Sha1: "b", ParentSha1: "a", Role: conv.ChatRoleUser, Content: "Review   this\nfile", CreatedAt: created.Add(time.Minute), Tags: []string{"review"}},
+		{Sha1: "c", ParentSha1: "b", Role: conv.ChatRoleAssistant, Content: "Looks good.", CreatedAt: created, Model: "gpt-4o", Tags: []string{"review", "good"}},
+	}
+	modTime := created.Add(time.Hour)
+
+	s := Summarize("20240301-120000.yaml", conv.FromMessages(config.InitialProfile(), "", "Review", "", messages), modTime)
+	if s.ID != "20240301-120000" || s.Title != "Review" || s.Preview != "Review this file" || s.Messages != 3 {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+	if !s.CreatedAt.Equal(created) || !s.UpdatedAt.Equal(modTime) {
+		t.Errorf("Expected the earliest message and the modification time, but got %v and %v", s.CreatedAt, s.UpdatedAt)
+	}
+	if s.Model != "gpt-4o" || !reflect.DeepEqual(s.Tags, []string{"review", "good"}) {
+		t.Errorf("Expected the model of the reply and unique tags, but got %s and %q", s.Model, s.Tags)
+	}
+
+	old := Summarize("20230102-030405.yaml", conv.FromMessages(config.InitialProfile(), "", "", "", []conv.Message{{Role: conv.ChatRoleUser, Content: "hi"}}), modTime)
+	if want := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local); !old.CreatedAt.Equal(want) {
+		t.Errorf("Expected the creation time from the file name, but got %v", old.CreatedAt)
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+
+	claude := config.InitialProfile()
+	claude.ProfileName = "Claude"
+	saveAt(t, "first", config.InitialProfile(), "one", day)
+	saveAt(t, "second", claude, "two", day.AddDate(0, 0, 1))
+	saveAt(t, "third", config.InitialProfile(), "three", day.AddDate(0, 0, 2))
+
+	tests := []struct {
+		name     string
+		opts     ListOptions
+		expected []string
+	}{
+		{name: "all", opts: ListOptions{}, expected: []string{"third", "second", "first"}},
+		{name: "since", opts: ListOptions{Since: day.Add(time.Hour)}, expected: []string{"third", "second"}},
+		{name: "until", opts: ListOptions{Until: day.Add(time.Hour)}, expected: []string{"first"}},
+		{name: "profile", opts: ListOptions{Profile: "claude"}, expected: []string{"second"}},
+		{name: "limit", opts: ListOptions{Limit: 1}, expected: []string{"third"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summaries, err := List(tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := ids(summaries); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHistoryIndexRefresh(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	saveAt(t, "first", config.InitialProfile(), "one", day)
+	saveAt(t, "second", config.InitialProfile(), "two", day)
+	if _, err := List(ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files changed without going through SaveAs are picked up by their modification time.
+	dir := config.MustGetHistoryDir()
+	data, err := os.ReadFile(filepath.Join(dir, "second.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "first.yaml"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "first.yaml"), day.Add(time.Hour), day.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "second.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := List(ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].ID != "first" || summaries[0].Preview != "two" {
+		t.Errorf("Expected the modified file only, but got %+v", summaries)
+	}
+
+	if err := os.WriteFile(historyIndexPath(), []byte("{broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if summaries, err := List(ListOptions{}); err != nil || len(summaries) != 1 {
+		t.Errorf("Expected a broken index to be rebuilt, but got %+v, %v", summaries, err)
+	}
+}
+
+func TestHistoryIndexSkipsFailed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	saveAt(t, "first", config.InitialProfile(), "one", day)
+
+	broken := filepath.Join(config.MustGetHistoryDir(), "broken.yaml")
+	if err := os.WriteFile(broken, []byte("{broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if summaries, err := List(ListOptions{}); err != nil || len(summaries) != 1 {
+		t.Fatalf("Expected the broken file to be skipped, but got %+v, %v", summaries, err)
+	}
+
+	// The index is not written again while the broken file stays the same.
+	if err := os.Chtimes(historyIndexPath(), day, day); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := List(ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(historyIndexPath()); err != nil || !info.ModTime().Equal(day) {
+		t.Errorf("Expected the index to be kept, but it was written again: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(config.MustGetHistoryDir(), "first.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(broken, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if summaries, err := List(ListOptions{}); err != nil || len(summaries) != 2 {
+		t.Errorf("Expected the fixed file to be listed, but got %+v, %v", summaries, err)
+	}
+}
@@ -0,0 +1,229 @@
+package history
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PruneOptions - Which conversations to remove. Conversations not updated for OlderThan, or beyond the
+// KeepLast most recently updated ones, are removed. Zero values disable each rule.
+type PruneOptions struct {
+	OlderThan  time.Duration
+	KeepLast   int
+	KeepTagged bool
+}
+
+// PruneOptionsFromPolicy converts the retention policy of the config.
+func PruneOptionsFromPolicy(policy config.HistoryPolicy) (PruneOptions, error) {
+	opts := PruneOptions{KeepLast: policy.MaxCount, KeepTagged: policy.KeepTagged}
+	if policy.MaxAge != "" {
+		d, err := ParseDuration(policy.MaxAge)
+		if err != nil {
+			return opts, fmt.Errorf("invalid History.MaxAge: %v", err)
+		}
+		opts.OlderThan = d
+	}
+	if policy.MaxCount < 0 {
+		return opts, fmt.Errorf("History.MaxCount must be 0 or greater")
+	}
+	return opts, nil
+}
+
+// PruneCandidates returns the conversations to remove, oldest first.
+func PruneCandidates(opts PruneOptions, now time.Time) ([]Summary, error) {
+	summaries, err := List(ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return selectPrune(summaries, opts, now), nil
+}
+
+// selectPrune picks the conversations to remove from summaries sorted by update time, newest first.
+func selectPrune(summaries []Summary, opts PruneOptions, now time.Time) []Summary {
+	if opts.OlderThan <= 0 && opts.KeepLast <= 0 {
+		return nil
+	}
+
+	var selected []Summary
+	for i, s := range summaries {
+		if opts.KeepTagged && len(s.Tags) > 0 {
+			continue
+		}
+
+		expired := opts.OlderThan > 0 && now.Sub(s.UpdatedAt) > opts.OlderThan
+		overflow := opts.KeepLast > 0 && i >= opts.KeepLast
+		if expired || overflow {
+			selected = append(selected, s)
+		}
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].UpdatedAt.Before(selected[j].UpdatedAt)
+	})
+	return selected
+}
+
+// Find returns the conversation in the history directory with the given id.
+func Find(id string) (Summary, error) {
+	id = strings.TrimSuffix(filepath.Base(id), ".yaml")
+
+	summaries, err := List(ListOptions{})
+	if err != nil {
+		return Summary{}, err
+	}
+	for _, s := range summaries {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return Summary{}, fmt.Errorf("no conversation found in history: %s", id)
+}
+
+// Remove deletes the conversations from the history directory and drops them from the indexes,
+// so that their contents do not remain in the search index.
+func Remove(summaries []Summary) error {
+	historyIdx := loadHistoryIndex()
+	searchIdx := loadSearchIndex()
+
+	var errs []string
+	for _, s := range summaries {
+		file := s.ID + ".yaml"
+		if err := os.Remove(filepath.Join(config.MustGetHistoryDir(), file)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err.Error())
+			continue
+		}
+		historyIdx.remove(file)
+		searchIdx.remove(file)
+	}
+
+	if err := historyIdx.save(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := searchIdx.save(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to remove conversations: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ArchiveFilename returns a path in the archive directory for an archive created at t.
+// Archives are encrypted as a whole when encryption is enabled, and get an .age suffix.
+func ArchiveFilename(t time.Time) string {
+	name := fmt.Sprintf("aski-history-%s.tar.gz", t.Format(timeFormat))
+	if EncryptionEnabled() {
+		name += ".age"
+	}
+	return filepath.Join(config.MustGetArchiveDir(), name)
+}
+
+// Archive writes the conversations to a tar.gz file at path. The archive contains index.json
+// with the metadata of the conversations and their files under history/.
+// It is encrypted when encryption is enabled, as the index holds titles and previews.
+func Archive(path string, summaries []Summary) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if EncryptionEnabled() {
+		err = writeEncryptedArchive(f, summaries)
+	} else {
+		err = writeArchive(f, summaries)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+func writeEncryptedArchive(w io.Writer, summaries []Summary) error {
+	ew, err := encryptTo(w)
+	if err != nil {
+		return err
+	}
+	if err := writeArchive(ew, summaries); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+func writeArchive(w io.Writer, summaries []Summary) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	index, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeTarFile(tw, "index.json", index, time.Now()); err != nil {
+		return err
+	}
+
+	for _, s := range summaries {
+		// Files are decrypted, as the archive is encrypted as a whole when encryption is enabled.
+		data, err := readFile(filepath.Join(config.MustGetHistoryDir(), s.ID+".yaml"))
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, "history/"+s.ID+".yaml", data, s.UpdatedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Prune removes the conversations, archiving them first when archive is set.
+// It returns the path of the archive if one was written.
+func Prune(summaries []Summary, archive bool, now time.Time) (string, error) {
+	if len(summaries) == 0 {
+		return "", nil
+	}
+
+	path := ""
+	if archive {
+		path = ArchiveFilename(now)
+		if err := Archive(path, summaries); err != nil {
+			return "", fmt.Errorf("failed to archive: %v", err)
+		}
+	}
+
+	return path, Remove(summaries)
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"testing"
+	"time"
+)
+
+func TestSelectPrune(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	summaries := []Summary{
+		{ID: "new", UpdatedAt: now.Add(-1 * day)},
+		{ID: "middle", UpdatedAt: now.Add(-10 * day)},
+		{ID: "tagged", UpdatedAt: now.Add(-100 * day), Tags: []string{"good"}},
+		{ID: "old", UpdatedAt: now.Add(-200 * day)},
+	}
+
+	tests := []struct {
+		name     string
+		opts     PruneOptions
+		expected []string
+	}{
+		{"no rules", PruneOptions{}, nil},
+		{"older than", PruneOptions{OlderThan: 90 * day}, []string{"old", "tagged"}},
+		{"keep tagged", PruneOptions{OlderThan: 90 * day, KeepTagged: true}, []string{"old"}},
+		{"keep last", PruneOptions{KeepLast: 2}, []string{"old", "tagged"}},
+		{"both", PruneOptions{OlderThan: 5 * day, KeepLast: 3, KeepTagged: true}, []string{"old", "middle"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := selectPrune(summaries, tt.opts, now)
+			if len(selected) != len(tt.expected) {
+				t.Fatalf("Expected %v, but got %+v", tt.expected, selected)
+			}
+			for i, s := range selected {
+				if s.ID != tt.expected[i] {
+					t.Errorf("Expected %s at %d, but got %s", tt.expected[i], i, s.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneOptionsFromPolicy(t *testing.T) {
+	opts, err := PruneOptionsFromPolicy(config.HistoryPolicy{MaxAge: "2w", MaxCount: 100, KeepTagged: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.OlderThan != 14*24*time.Hour || opts.KeepLast != 100 || !opts.KeepTagged {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	if _, err := PruneOptionsFromPolicy(config.HistoryPolicy{MaxAge: "soon"}); err == nil {
+		t.Errorf("Expected an error for an invalid MaxAge")
+	}
+}
@@ -0,0 +1,175 @@
+package history
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const previewLength = 50
+
+// Entry - A saved conversation found in the current directory or the history directory.
+type Entry struct {
+	ID      string
+	Path    string
+	ModTime time.Time
+	Title   string
+	Preview string
+	Model   string
+}
+
+// Resolve finds the conversations matching the query, newest first. The query is a path, or an id
+// of a conversation in the current directory or the history directory. Exact matches win over prefix matches,
+// and prefix matches win over fuzzy matches on the id, title and preview. An empty query returns every conversation.
+func Resolve(query string) ([]Entry, error) {
+	if query != "" {
+		if info, err := os.Stat(query); err == nil && !info.IsDir() {
+			entry, err := describe(query, info.ModTime())
+			if err != nil {
+				return nil, err
+			}
+			return []Entry{entry}, nil
+		}
+	}
+
+	entries := entriesIn(".")
+	seen := map[string]bool{}
+	for _, e := range entries {
+		seen[absPath(e.Path)] = true
+	}
+	summaries, err := List(ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range summaries {
+		path := filepath.Join(config.MustGetHistoryDir(), s.ID+".yaml")
+		if !seen[absPath(path)] {
+			entries = append(entries, Entry{ID: s.ID, Path: path, ModTime: s.UpdatedAt, Title: s.Title, Preview: s.Preview, Model: s.Model})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime.After(entries[j].ModTime)
+	})
+
+	id := strings.TrimSuffix(query, ".yaml")
+	if id == "" {
+		return entries, nil
+	}
+
+	for _, e := range entries {
+		if e.ID == id {
+			return []Entry{e}, nil
+		}
+	}
+
+	var prefixed, fuzzy []Entry
+	for _, e := range entries {
+		if strings.HasPrefix(e.ID, id) {
+			prefixed = append(prefixed, e)
+		} else if fuzzyMatch(id, e.ID) || fuzzyMatch(id, e.Title) || fuzzyMatch(id, e.Preview) {
+			fuzzy = append(fuzzy, e)
+		}
+	}
+
+	if len(prefixed) > 0 {
+		return prefixed, nil
+	}
+	if len(fuzzy) > 0 {
+		return fuzzy, nil
+	}
+	return nil, fmt.Errorf("no conversation found matching: %s", query)
+}
+
+// entriesIn lists the conversations in a directory other than the history directory. Files are only listed
+// when they parse as a conversation, as other YAML files may be there.
+func entriesIn(dir string) []Entry {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".yaml") {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		entry, err := describe(filepath.Join(dir, file.Name()), info.ModTime())
+		if err != nil || entry.Preview == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func describe(path string, modTime time.Time) (Entry, error) {
+	cv, err := LoadFile(path)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{
+		ID:      strings.TrimSuffix(filepath.Base(path), ".yaml"),
+		Path:    path,
+		ModTime: modTime,
+		Title:   cv.GetTitle(),
+		Preview: Preview(cv),
+		Model:   cv.GetProfile().Model,
+	}, nil
+}
+
+// Preview returns the beginning of the first message written by the user, skipping file attachments.
+func Preview(cv conv.Conversation) string {
+	messages := cv.GetMessages()
+	if len(messages) == 0 {
+		return ""
+	}
+
+	content := messages[0].Content
+	for _, m := range messages {
+		if m.Role == conv.ChatRoleUser && m.Attachment == nil {
+			content = m.Content
+			break
+		}
+	}
+
+	content = strings.Join(strings.Fields(content), " ")
+	if len([]rune(content)) > previewLength {
+		content = string([]rune(content)[:previewLength]) + "..."
+	}
+	return content
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// fuzzyMatch reports whether the characters of the pattern appear in the text in order, ignoring case.
+func fuzzyMatch(pattern, text string) bool {
+	pattern = strings.ToLower(pattern)
+	text = strings.ToLower(text)
+
+	i := 0
+	p := []rune(pattern)
+	for _, r := range text {
+		if i < len(p) && r == p[i] {
+			i++
+		}
+	}
+	return len(p) > 0 && i == len(p)
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	saveAt(t, "20240301-120000", config.InitialProfile(), "Fix the parser", day)
+	saveAt(t, "20240302-120000", config.InitialProfile(), "Deploy the server", day.AddDate(0, 0, 1))
+	saveAt(t, "20240302-120000-copy", config.InitialProfile(), "Deploy again", day.AddDate(0, 0, 2))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{name: "exact", query: "20240302-120000", expected: []string{"20240302-120000"}},
+		{name: "exact with extension", query: "20240302-120000.yaml", expected: []string{"20240302-120000"}},
+		{name: "prefix", query: "20240302", expected: []string{"20240302-120000-copy", "20240302-120000"}},
+		{name: "prefix over fuzzy", query: "20240301", expected: []string{"20240301-120000"}},
+		{name: "fuzzy preview", query: "deploy", expected: []string{"20240302-120000-copy", "20240302-120000"}},
+		{name: "fuzzy", query: "prsr", expected: []string{"20240301-120000"}},
+		{name: "empty", query: "", expected: []string{"20240302-120000-copy", "20240302-120000", "20240301-120000"}},
+		{name: "path", query: filepath.Join(config.MustGetHistoryDir(), "20240301-120000.yaml"), expected: []string{"20240301-120000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := Resolve(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.ID)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := Resolve("zzz"); err == nil {
+		t.Errorf("Expected an error when nothing matches")
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	if !fuzzyMatch("DPS", "deploy the server") || fuzzyMatch("spd", "deploy the server") || fuzzyMatch("", "text") {
+		t.Errorf("Expected the characters to match in order, ignoring case")
+	}
+}
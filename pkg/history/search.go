@@ -0,0 +1,415 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	searchIndexFile = "search-index.json"
+	// maxTermLength keeps long tokens such as base64 blobs in attachments from bloating the index.
+	maxTermLength = 64
+	snippetRadius = 60
+)
+
+// searchIndex maps terms to the files containing them. It narrows down the files to scan for keyword searches.
+type searchIndex struct {
+	// Files holds the modification time of each file when it was indexed.
+	Files    map[string]int64    `json:"files"`
+	Postings map[string][]string `json:"postings"`
+}
+
+// SearchOptions - A query and filters for Search. Query is a list of keywords, or a regular expression when Regex is set.
+type SearchOptions struct {
+	Query   string
+	Regex   bool
+	Role    string
+	Profile string
+	Model   string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// Match - A message matching the search, with a snippet around the match.
+type Match struct {
+	File    string
+	Message conv.Message
+	Time    time.Time
+	Snippet string
+	// Start and End locate the match in the snippet.
+	Start int
+	End   int
+}
+
+// Search returns the messages in the history matching the options, newest first.
+func Search(opts SearchOptions) ([]Match, error) {
+	match, err := matcher(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := refreshedSearchIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	files := idx.candidates(opts)
+
+	var matches []Match
+	for _, file := range files {
+		cv, err := Load(file)
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(config.MustGetHistoryDir(), file))
+		if err != nil {
+			continue
+		}
+
+		profile := cv.GetProfile()
+		if opts.Profile != "" && !strings.EqualFold(profile.ProfileName, opts.Profile) {
+			continue
+		}
+
+		for _, m := range cv.GetMessages() {
+			if opts.Role != "" && m.Role != opts.Role {
+				continue
+			}
+
+			model := m.Model
+			if model == "" {
+				model = profile.Model
+			}
+			if opts.Model != "" && !strings.Contains(strings.ToLower(model), strings.ToLower(opts.Model)) {
+				continue
+			}
+
+			t := m.CreatedAt
+			if t.IsZero() {
+				t = info.ModTime()
+			}
+			if (!opts.Since.IsZero() && t.Before(opts.Since)) || (!opts.Until.IsZero() && t.After(opts.Until)) {
+				continue
+			}
+
+			start, end, ok := match(m.Content)
+			if !ok {
+				continue
+			}
+
+			snippet, s, e := makeSnippet(m.Content, start, end)
+			matches = append(matches, Match{File: file, Message: m, Time: t, Snippet: snippet, Start: s, End: e})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Time.After(matches[j].Time)
+	})
+
+	if opts.Limit > 0 && len(matches) > opts.Limit {
+		matches = matches[:opts.Limit]
+	}
+	return matches, nil
+}
+
+// Reindex rebuilds the search index from every file in the history directory.
+func Reindex() error {
+	idx := &searchIndex{Files: map[string]int64{}, Postings: map[string][]string{}}
+	if err := idx.refresh(); err != nil {
+		return err
+	}
+	return idx.save()
+}
+
+// matcher returns a function that locates the first match of the query in a message.
+// Keywords match case-insensitively and all of them must be present.
+func matcher(opts SearchOptions) (func(content string) (int, int, bool), error) {
+	if opts.Regex {
+		re, err := regexp.Compile(opts.Query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		return func(content string) (int, int, bool) {
+			loc := re.FindStringIndex(content)
+			if loc == nil {
+				return 0, 0, false
+			}
+			return loc[0], loc[1], true
+		}, nil
+	}
+
+	keywords := strings.Fields(strings.ToLower(opts.Query))
+	if len(keywords) == 0 {
+		return nil, fmt.Errorf("no keywords provided")
+	}
+
+	return func(content string) (int, int, bool) {
+		lower := strings.ToLower(content)
+		first, firstEnd := -1, -1
+		for _, k := range keywords {
+			i := strings.Index(lower, k)
+			if i < 0 {
+				return 0, 0, false
+			}
+			if first < 0 {
+				first, firstEnd = i, i+len(k)
+			}
+		}
+		// Lowercasing may change byte lengths, fall back to the start of the message in that case.
+		if len(lower) != len(content) {
+			return 0, 0, true
+		}
+		return first, firstEnd, true
+	}, nil
+}
+
+func makeSnippet(content string, start, end int) (string, int, int) {
+	from := start
+	for i := 0; i < snippetRadius && from > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(content[:from])
+		from -= size
+	}
+	to := end
+	for i := 0; i < snippetRadius && to < len(content); i++ {
+		_, size := utf8.DecodeRuneInString(content[to:])
+		to += size
+	}
+
+	prefix, suffix := "", ""
+	if from > 0 {
+		prefix = "..."
+	}
+	if to < len(content) {
+		suffix = "..."
+	}
+
+	clean := func(s string) string {
+		return strings.NewReplacer("\r", " ", "\n", " ", "\t", " ").Replace(s)
+	}
+	before := prefix + clean(content[from:start])
+	matched := clean(content[start:end])
+	return before + matched + clean(content[end:to]) + suffix, len(before), len(before) + len(matched)
+}
+
+// terms splits the text into lowercase words. Each CJK character is a term by itself,
+// as those languages do not separate words with spaces.
+func terms(text string) []string {
+	var result []string
+	var b strings.Builder
+	length := 0
+
+	flush := func() {
+		if b.Len() > 0 {
+			result = append(result, b.String())
+			b.Reset()
+			length = 0
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flush()
+			result = append(result, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if length < maxTermLength {
+				b.WriteRune(r)
+				length++
+			}
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return result
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func searchIndexPath() string {
+	return filepath.Join(config.MustGetAskiDir(), searchIndexFile)
+}
+
+func loadSearchIndex() *searchIndex {
+	idx := &searchIndex{Files: map[string]int64{}, Postings: map[string][]string{}}
+
+	data, err := readFile(searchIndexPath())
+	if err != nil {
+		return idx
+	}
+
+	if err := json.Unmarshal(data, idx); err != nil || idx.Files == nil || idx.Postings == nil {
+		return &searchIndex{Files: map[string]int64{}, Postings: map[string][]string{}}
+	}
+	return idx
+}
+
+// refreshedSearchIndex loads the index and brings it up to date with the history directory.
+func refreshedSearchIndex() (*searchIndex, error) {
+	idx := loadSearchIndex()
+	if err := idx.refresh(); err != nil {
+		return nil, err
+	}
+	return idx, idx.save()
+}
+
+func (idx *searchIndex) save() error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(config.MustGetAskiDir(), 0700); err != nil {
+		return err
+	}
+	return writeFile(searchIndexPath(), data)
+}
+
+// refresh indexes new or modified files and drops deleted ones.
+func (idx *searchIndex) refresh() error {
+	files, err := Files()
+	if err != nil {
+		return err
+	}
+
+	exists := map[string]bool{}
+	for _, file := range files {
+		exists[file] = true
+
+		info, err := os.Stat(filepath.Join(config.MustGetHistoryDir(), file))
+		if err != nil {
+			continue
+		}
+		if idx.Files[file] == info.ModTime().UnixNano() {
+			continue
+		}
+
+		cv, err := Load(file)
+		if err != nil {
+			idx.remove(file)
+			continue
+		}
+		idx.update(file, cv, info.ModTime())
+	}
+
+	for file := range idx.Files {
+		if !exists[file] {
+			idx.remove(file)
+		}
+	}
+	return nil
+}
+
+func (idx *searchIndex) update(file string, cv conv.Conversation, modTime time.Time) {
+	idx.remove(file)
+
+	seen := map[string]bool{}
+	for _, m := range cv.GetMessages() {
+		for _, t := range terms(m.Content) {
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			idx.Postings[t] = append(idx.Postings[t], file)
+		}
+	}
+	idx.Files[file] = modTime.UnixNano()
+}
+
+func (idx *searchIndex) remove(file string) {
+	if _, ok := idx.Files[file]; !ok {
+		return
+	}
+
+	for t, files := range idx.Postings {
+		kept := files[:0]
+		for _, f := range files {
+			if f != file {
+				kept = append(kept, f)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.Postings, t)
+		} else {
+			idx.Postings[t] = kept
+		}
+	}
+	delete(idx.Files, file)
+}
+
+// candidates returns the files that may contain every keyword. Regular expressions cannot use the index,
+// so every file is returned for them.
+func (idx *searchIndex) candidates(opts SearchOptions) []string {
+	all := make([]string, 0, len(idx.Files))
+	for file := range idx.Files {
+		all = append(all, file)
+	}
+	sort.Strings(all)
+
+	if opts.Regex {
+		return all
+	}
+
+	var result map[string]bool
+	for _, keyword := range strings.Fields(opts.Query) {
+		for _, t := range terms(keyword) {
+			found := map[string]bool{}
+			for indexed, files := range idx.Postings {
+				if indexed == t || (!isCJK([]rune(t)[0]) && strings.Contains(indexed, t)) {
+					for _, f := range files {
+						found[f] = true
+					}
+				}
+			}
+
+			if result == nil {
+				result = found
+				continue
+			}
+			for f := range result {
+				if !found[f] {
+					delete(result, f)
+				}
+			}
+		}
+	}
+
+	if result == nil {
+		return all
+	}
+
+	var files []string
+	for _, file := range all {
+		if result[file] {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// updateSearchIndex indexes a conversation that has just been saved.
+func updateSearchIndex(file string, cv conv.Conversation) error {
+	info, err := os.Stat(filepath.Join(config.MustGetHistoryDir(), file))
+	if err != nil {
+		return err
+	}
+
+	idx := loadSearchIndex()
+	idx.update(file, cv, info.ModTime())
+	return idx.save()
+}
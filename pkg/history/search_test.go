@@ -0,0 +1,110 @@
+package history
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "Hello, World_42!", expected: []string{"hello", "world", "42"}},
+		{text: "日本語のテキスト", expected: []string{"日", "本", "語", "の", "テ", "キ", "ス", "ト"}},
+		{text: "Go言語で書く", expected: []string{"go", "言", "語", "で", "書", "く"}},
+		{text: "한국어 text", expected: []string{"한", "국", "어", "text"}},
+		{text: strings.Repeat("a", 100), expected: []string{strings.Repeat("a", maxTermLength)}},
+		{text: " ... ", expected: nil},
+	}
+
+	for _, tt := range tests {
+		if got := terms(tt.text); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("terms(%q) = %q, expected %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	idx := &searchIndex{
+		Files: map[string]int64{"a.yaml": 1, "b.yaml": 1, "c.yaml": 1},
+		Postings: map[string][]string{
+			"golang": {"a.yaml"},
+			"go":     {"b.yaml"},
+			"日":      {"a.yaml", "c.yaml"},
+			"本":      {"c.yaml"},
+			"本当":     {"b.yaml"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		opts     SearchOptions
+		expected []string
+	}{
+		{name: "substring", opts: SearchOptions{Query: "GO"}, expected: []string{"a.yaml", "b.yaml"}},
+		{name: "word", opts: SearchOptions{Query: "golang"}, expected: []string{"a.yaml"}},
+		{name: "cjk", opts: SearchOptions{Query: "日本"}, expected: []string{"c.yaml"}},
+		{name: "all keywords", opts: SearchOptions{Query: "go 日"}, expected: []string{"a.yaml"}},
+		{name: "no match", opts: SearchOptions{Query: "rust"}, expected: nil},
+		{name: "no terms", opts: SearchOptions{Query: "..."}, expected: []string{"a.yaml", "b.yaml", "c.yaml"}},
+		{name: "regex", opts: SearchOptions{Query: "go+", Regex: true}, expected: []string{"a.yaml", "b.yaml", "c.yaml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idx.candidates(tt.opts); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	match, err := matcher(SearchOptions{Query: "World hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if start, end, ok := match("Hello, world"); !ok || start != 7 || end != 12 {
+		t.Errorf("Expected the first keyword to be located, but got %d, %d, %v", start, end, ok)
+	}
+	if _, _, ok := match("hello"); ok {
+		t.Errorf("Expected every keyword to be required")
+	}
+
+	if _, err := matcher(SearchOptions{Query: "  "}); err == nil {
+		t.Errorf("Expected an error for a missing keyword")
+	}
+	if _, err := matcher(SearchOptions{Query: "(", Regex: true}); err == nil {
+		t.Errorf("Expected an error for an invalid regular expression")
+	}
+}
+
+func TestMakeSnippet(t *testing.T) {
+	a, b := strings.Repeat("a", 100), strings.Repeat("b", 100)
+	kana := strings.Repeat("あ", 70)
+
+	tests := []struct {
+		name       string
+		content    string
+		start, end int
+		snippet    string
+		s, e       int
+	}{
+		{name: "short", content: "hello\nworld", start: 6, end: 11, snippet: "hello world", s: 6, e: 11},
+		{name: "long", content: a + "match" + b, start: 100, end: 105,
+			snippet: "..." + a[:snippetRadius] + "match" + b[:snippetRadius] + "...", s: 3 + snippetRadius, e: 8 + snippetRadius},
+		{name: "multibyte", content: kana + "一致", start: len(kana), end: len(kana) + len("一致"),
+			snippet: "..." + strings.Repeat("あ", snippetRadius) + "一致", s: 3 + len("あ")*snippetRadius, e: 3 + len("あ")*snippetRadius + len("一致")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet, s, e := makeSnippet(tt.content, tt.start, tt.end)
+			if snippet != tt.snippet || s != tt.s || e != tt.e {
+				t.Errorf("Expected %q, %d, %d, but got %q, %d, %d", tt.snippet, tt.s, tt.e, snippet, s, e)
+			}
+		})
+	}
+}
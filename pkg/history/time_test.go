@@ -0,0 +1,54 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected time.Duration
+	}{
+		{s: "90d", expected: 90 * 24 * time.Hour},
+		{s: "2w", expected: 14 * 24 * time.Hour},
+		{s: " 12h ", expected: 12 * time.Hour},
+		{s: "1h30m", expected: 90 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got, err := ParseDuration(tt.s); err != nil || got != tt.expected {
+			t.Errorf("ParseDuration(%q) = %v, %v, expected %v", tt.s, got, err, tt.expected)
+		}
+	}
+
+	for _, s := range []string{"-3d", "xd", "soon", ""} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		s        string
+		expected time.Time
+	}{
+		{s: "2024-03-01", expected: time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)},
+		{s: "2024-03-01T09:30:00Z", expected: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{s: "30d", expected: now.Add(-30 * 24 * time.Hour)},
+		{s: "2h", expected: now.Add(-2 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		if got, err := ParseTime(tt.s, now); err != nil || !got.Equal(tt.expected) {
+			t.Errorf("ParseTime(%q) = %v, %v, expected %v", tt.s, got, err, tt.expected)
+		}
+	}
+
+	if _, err := ParseTime("2024/03/01", now); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
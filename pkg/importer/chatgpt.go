@@ -0,0 +1,164 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	chatGPTConversation struct {
+		ID             string                 `json:"id"`
+		ConversationID string                 `json:"conversation_id"`
+		Title          string                 `json:"title"`
+		CreateTime     float64                `json:"create_time"`
+		Mapping        map[string]chatGPTNode `json:"mapping"`
+		CurrentNode    string                 `json:"current_node"`
+	}
+
+	chatGPTNode struct {
+		ID       string          `json:"id"`
+		Message  *chatGPTMessage `json:"message"`
+		Parent   string          `json:"parent"`
+		Children []string        `json:"children"`
+	}
+
+	chatGPTMessage struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		CreateTime float64 `json:"create_time"`
+		Content    struct {
+			ContentType string            `json:"content_type"`
+			Parts       []json.RawMessage `json:"parts"`
+			Text        string            `json:"text"`
+		} `json:"content"`
+		Metadata struct {
+			ModelSlug string `json:"model_slug"`
+		} `json:"metadata"`
+	}
+)
+
+// fromChatGPT parses conversations.json of the ChatGPT data export. Each conversation is a tree of nodes
+// linked by parent and children ids. System and tool messages are skipped and their children are attached to their parent.
+func fromChatGPT(data []byte, profile config.Profile) ([]Conversation, error) {
+	var exported []chatGPTConversation
+	if err := json.Unmarshal(arrayOf(data), &exported); err != nil {
+		return nil, fmt.Errorf("cannot parse ChatGPT export: %v", err)
+	}
+
+	var result []Conversation
+	for _, c := range exported {
+		b := newTreeBuilder()
+		system := ""
+
+		var visit func(id string)
+		visit = func(id string) {
+			node, ok := c.Mapping[id]
+			if !ok {
+				return
+			}
+
+			role, content := "", ""
+			if node.Message != nil {
+				role = node.Message.Author.Role
+				content = chatGPTContent(node.Message)
+			}
+
+			switch {
+			case content != "" && (role == conv.ChatRoleUser || role == conv.ChatRoleAssistant):
+				msg := conv.Message{
+					Role:      role,
+					Content:   content,
+					CreatedAt: fromUnix(node.Message.CreateTime),
+				}
+				if role == conv.ChatRoleUser {
+					msg.UserName = profile.UserName
+				} else {
+					msg.Model = node.Message.Metadata.ModelSlug
+				}
+				b.add(node.ID, node.Parent, msg)
+			case content != "" && role == "system" && system == "":
+				system = content
+				b.skip(node.ID, node.Parent)
+			default:
+				b.skip(node.ID, node.Parent)
+			}
+
+			for _, child := range node.Children {
+				visit(child)
+			}
+		}
+
+		for _, root := range chatGPTRoots(c.Mapping) {
+			visit(root)
+		}
+
+		messages := b.build(c.CurrentNode)
+		if len(messages) == 0 {
+			continue
+		}
+
+		if system == "" {
+			system = profile.SystemContext
+		}
+
+		id := c.ConversationID
+		if id == "" {
+			id = c.ID
+		}
+
+		result = append(result, Conversation{
+			Conversation: conv.FromMessages(profile, system, c.Title, FormatChatGPT+":"+id, messages),
+			CreatedAt:    fromUnix(c.CreateTime),
+		})
+	}
+
+	return result, nil
+}
+
+// chatGPTRoots returns the ids of the nodes without a parent in a stable order.
+func chatGPTRoots(mapping map[string]chatGPTNode) []string {
+	var roots []string
+	for id, node := range mapping {
+		if _, ok := mapping[node.Parent]; !ok {
+			roots = append(roots, id)
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+func chatGPTContent(m *chatGPTMessage) string {
+	if m.Content.Text != "" {
+		return m.Content.Text
+	}
+
+	var parts []string
+	for _, raw := range m.Content.Parts {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			// Images and other attachments are exported as objects.
+			parts = append(parts, "[attachment]")
+			continue
+		}
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+func fromUnix(seconds float64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
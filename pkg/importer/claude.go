@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"strings"
+	"time"
+)
+
+type (
+	claudeConversation struct {
+		UUID         string          `json:"uuid"`
+		Name         string          `json:"name"`
+		Model        string          `json:"model"`
+		CreatedAt    time.Time       `json:"created_at"`
+		ChatMessages []claudeMessage `json:"chat_messages"`
+	}
+
+	claudeMessage struct {
+		UUID              string    `json:"uuid"`
+		ParentMessageUUID string    `json:"parent_message_uuid"`
+		Text              string    `json:"text"`
+		Sender            string    `json:"sender"`
+		CreatedAt         time.Time `json:"created_at"`
+		Content           []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Attachments []struct {
+			FileName         string `json:"file_name"`
+			ExtractedContent string `json:"extracted_content"`
+		} `json:"attachments"`
+	}
+)
+
+// fromClaude parses conversations.json of the Claude.ai data export. Messages are linked by parent_message_uuid
+// when it is present, otherwise each message replies to the previous one. Attachments become attachment messages.
+func fromClaude(data []byte, profile config.Profile) ([]Conversation, error) {
+	var exported []claudeConversation
+	if err := json.Unmarshal(arrayOf(data), &exported); err != nil {
+		return nil, fmt.Errorf("cannot parse Claude.ai export: %v", err)
+	}
+
+	var result []Conversation
+	for _, c := range exported {
+		b := newTreeBuilder()
+		previous := ""
+
+		for _, m := range c.ChatMessages {
+			parent := m.ParentMessageUUID
+			if parent == "" {
+				parent = previous
+			}
+			previous = m.UUID
+
+			role := conv.ChatRoleAssistant
+			if m.Sender == "human" {
+				role = conv.ChatRoleUser
+			}
+
+			if role == conv.ChatRoleUser {
+				for i, a := range m.Attachments {
+					if a.ExtractedContent == "" {
+						continue
+					}
+					id := fmt.Sprintf("%s/attachment/%d", m.UUID, i)
+					b.add(id, parent, conv.Message{
+						Role:       conv.ChatRoleUser,
+						Content:    fmt.Sprintf("Path: `%s`\n ```\n%s```", a.FileName, a.ExtractedContent),
+						UserName:   profile.UserName,
+						CreatedAt:  m.CreatedAt,
+						Attachment: &conv.Attachment{Path: a.FileName},
+					})
+					parent = id
+				}
+			}
+
+			content := claudeContent(m)
+			if content == "" {
+				b.skip(m.UUID, parent)
+				continue
+			}
+
+			msg := conv.Message{
+				Role:      role,
+				Content:   content,
+				CreatedAt: m.CreatedAt,
+			}
+			if role == conv.ChatRoleUser {
+				msg.UserName = profile.UserName
+			} else {
+				msg.Model = c.Model
+			}
+			b.add(m.UUID, parent, msg)
+		}
+
+		messages := b.build(previous)
+		if len(messages) == 0 {
+			continue
+		}
+
+		result = append(result, Conversation{
+			Conversation: conv.FromMessages(profile, profile.SystemContext, c.Name, FormatClaude+":"+c.UUID, messages),
+			CreatedAt:    c.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func claudeContent(m claudeMessage) string {
+	if strings.TrimSpace(m.Text) != "" {
+		return strings.TrimSpace(m.Text)
+	}
+
+	var parts []string
+	for _, c := range m.Content {
+		if c.Type == "text" && c.Text != "" {
+			parts = append(parts, c.Text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
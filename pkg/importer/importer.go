@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatChatGPT = "chatgpt"
+	FormatClaude  = "claude"
+)
+
+// Conversation - An imported conversation with the time it was started.
+type Conversation struct {
+	Conversation conv.Conversation
+	CreatedAt    time.Time
+}
+
+// Import parses a ChatGPT or Claude.ai data export. An empty format detects it from the contents.
+// The profile is used for the imported conversations, so that they can be restored as usual.
+func Import(data []byte, format string, profile config.Profile) ([]Conversation, error) {
+	if format == "" {
+		detected, err := Detect(data)
+		if err != nil {
+			return nil, err
+		}
+		format = detected
+	}
+
+	switch format {
+	case FormatChatGPT:
+		return fromChatGPT(data, profile)
+	case FormatClaude:
+		return fromClaude(data, profile)
+	default:
+		return nil, fmt.Errorf("unknown import format: %s, must be chatgpt or claude", format)
+	}
+}
+
+// Detect returns the format of the export from the keys of its first conversation.
+func Detect(data []byte) (string, error) {
+	var conversations []map[string]json.RawMessage
+	if err := json.Unmarshal(arrayOf(data), &conversations); err != nil {
+		return "", fmt.Errorf("cannot parse export: %v", err)
+	}
+
+	if len(conversations) == 0 {
+		return "", fmt.Errorf("no conversations found in export")
+	}
+
+	if _, ok := conversations[0]["mapping"]; ok {
+		return FormatChatGPT, nil
+	}
+	if _, ok := conversations[0]["chat_messages"]; ok {
+		return FormatClaude, nil
+	}
+
+	return "", fmt.Errorf("unknown export format, expected ChatGPT conversations.json or Claude.ai export")
+}
+
+// arrayOf wraps a single exported conversation into an array.
+func arrayOf(data []byte) []byte {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		return []byte("[" + trimmed + "]")
+	}
+	return data
+}
+
+// treeBuilder converts messages identified by the ids of the export into aski messages.
+// Messages whose content is identical to a sibling are merged, as aski identifies messages by their SHA1.
+type treeBuilder struct {
+	messages []conv.Message
+	shas     map[string]string
+	known    map[string]bool
+}
+
+func newTreeBuilder() *treeBuilder {
+	return &treeBuilder{
+		shas:  map[string]string{},
+		known: map[string]bool{},
+	}
+}
+
+// add appends a message as a child of the message with parentID. Unknown parents are treated as the root.
+func (b *treeBuilder) add(id string, parentID string, msg conv.Message) {
+	parent, ok := b.shas[parentID]
+	if !ok {
+		parent = "ROOT"
+	}
+
+	msg.ParentSha1 = parent
+	msg.Sha1 = conv.CalculateSHA1([]string{msg.Role, msg.Content, parent})
+	b.shas[id] = msg.Sha1
+
+	if b.known[msg.Sha1] {
+		return
+	}
+	b.known[msg.Sha1] = true
+	b.messages = append(b.messages, msg)
+}
+
+// skip maps a message that is not imported, such as a hidden system message, to its parent.
+func (b *treeBuilder) skip(id string, parentID string) {
+	if parent, ok := b.shas[parentID]; ok {
+		b.shas[id] = parent
+	}
+}
+
+// build returns the messages with HEAD at the message with headID, or at the last message if it is unknown.
+func (b *treeBuilder) build(headID string) []conv.Message {
+	head, ok := b.shas[headID]
+	if !ok && len(b.messages) > 0 {
+		head = b.messages[len(b.messages)-1].Sha1
+	}
+
+	for i := range b.messages {
+		b.messages[i].Head = b.messages[i].Sha1 == head
+	}
+	return b.messages
+}
@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"testing"
+)
+
+const chatGPTExport = `[{
+  "title": "Go generics",
+  "create_time": 1700000000.5,
+  "conversation_id": "c-1",
+  "current_node": "a2",
+  "mapping": {
+    "root": {"id": "root", "message": null, "parent": null, "children": ["sys"]},
+    "sys": {"id": "sys", "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]}}, "parent": "root", "children": ["u1"]},
+    "u1": {"id": "u1", "message": {"author": {"role": "user"}, "create_time": 1700000001, "content": {"content_type": "text", "parts": ["What are generics?"]}}, "parent": "sys", "children": ["a1", "a2"]},
+    "a1": {"id": "a1", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["First answer"]}, "metadata": {"model_slug": "gpt-4"}}, "parent": "u1", "children": []},
+    "a2": {"id": "a2", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["Regenerated answer"]}, "metadata": {"model_slug": "gpt-4o"}}, "parent": "u1", "children": []}
+  }
+}]`
+
+const claudeExport = `[{
+  "uuid": "c-2",
+  "name": "Review",
+  "created_at": "2024-03-05T12:00:00.000000+00:00",
+  "chat_messages": [
+    {"uuid": "m1", "text": "Review this", "sender": "human", "created_at": "2024-03-05T12:00:01+00:00",
+     "attachments": [{"file_name": "main.go", "extracted_content": "package main\n"}]},
+    {"uuid": "m2", "text": "Looks good", "sender": "assistant", "created_at": "2024-03-05T12:00:02+00:00"}
+  ]
+}]`
+
+func TestImportChatGPT(t *testing.T) {
+	imported, err := Import([]byte(chatGPTExport), "", config.InitialProfile())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imported) != 1 {
+		t.Fatalf("Expected 1 conversation, but got %d", len(imported))
+	}
+
+	cv := imported[0].Conversation
+	if cv.GetTitle() != "Go generics" || cv.GetSource() != "chatgpt:c-1" {
+		t.Errorf("Unexpected title or source: %s, %s", cv.GetTitle(), cv.GetSource())
+	}
+	if len(cv.GetMessages()) != 3 {
+		t.Fatalf("Expected 3 messages with a branch, but got %d", len(cv.GetMessages()))
+	}
+
+	chain := cv.MessagesFromHead()
+	if len(chain) != 2 || chain[0].ParentSha1 != "ROOT" || chain[1].Content != "Regenerated answer" || chain[1].Model != "gpt-4o" {
+		t.Errorf("Unexpected HEAD chain: %+v", chain)
+	}
+	if chain[0].CreatedAt.Unix() != 1700000001 {
+		t.Errorf("Expected the timestamp to be kept, but got %v", chain[0].CreatedAt)
+	}
+}
+
+func TestImportClaude(t *testing.T) {
+	imported, err := Import([]byte(claudeExport), "", config.InitialProfile())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imported) != 1 {
+		t.Fatalf("Expected 1 conversation, but got %d", len(imported))
+	}
+
+	chain := imported[0].Conversation.MessagesFromHead()
+	if len(chain) != 3 {
+		t.Fatalf("Expected attachment, question and answer, but got %d messages", len(chain))
+	}
+	if chain[0].Attachment == nil || chain[0].Attachment.Path != "main.go" {
+		t.Errorf("Expected an attachment message first, but got %+v", chain[0])
+	}
+	if chain[1].Role != conv.ChatRoleUser || chain[2].Role != conv.ChatRoleAssistant {
+		t.Errorf("Unexpected roles: %s, %s", chain[1].Role, chain[2].Role)
+	}
+}
+
+func TestDetectUnknownFormat(t *testing.T) {
+	if _, err := Detect([]byte(`[{"foo": 1}]`)); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"github.com/kznrluk/aski/pkg/command"
+	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/nyaosorg/go-readline-ny"
+	"path/filepath"
+	"strings"
+)
+
+// maxListedCandidates limits the candidates listed below the prompt.
+const maxListedCandidates = 20
+
+// completeCommand completes the word before the cursor in inline commands. A single candidate is inserted,
+// several are inserted up to their common prefix, or listed below the prompt when there is nothing to insert.
+// The conversation is read on every completion, as the dialog replaces it.
+func completeCommand(current func() conv.Conversation) readline.Command {
+	return readline.AnonymousCommand(func(ctx context.Context, B *readline.Buffer) readline.Result {
+		word, start := B.CurrentWord()
+		candidates := command.Complete(B.SubString(0, B.Cursor), current())
+
+		switch {
+		case len(candidates) == 0:
+			_, _ = B.Out.WriteString("\a")
+		case len(candidates) == 1:
+			value := candidates[0].Value
+			if !strings.HasSuffix(value, string(filepath.Separator)) {
+				value += " "
+			}
+			B.ReplaceAndRepaint(start, value)
+		default:
+			if prefix := command.CommonPrefix(candidates); len(prefix) > len(word) {
+				B.ReplaceAndRepaint(start, prefix)
+				break
+			}
+			_, _ = B.Out.WriteString("\n" + listCandidates(candidates))
+			B.RepaintLastLine()
+		}
+		return readline.CONTINUE
+	})
+}
+
+// listCandidates puts candidates with hints on their own lines, and the others on a single line.
+func listCandidates(candidates []command.Candidate) string {
+	more := ""
+	if len(candidates) > maxListedCandidates {
+		more = fmt.Sprintf("...and %d more\n", len(candidates)-maxListedCandidates)
+		candidates = candidates[:maxListedCandidates]
+	}
+
+	if candidates[0].Hint == "" {
+		var values []string
+		for _, c := range candidates {
+			values = append(values, c.Value)
+		}
+		return strings.Join(values, "  ") + "\n" + more
+	}
+
+	var b strings.Builder
+	for _, c := range candidates {
+		b.WriteString(fmt.Sprintf("%-14s %s\n", c.Value, c.Hint))
+	}
+	return b.String() + more
+}
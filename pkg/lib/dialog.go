@@ -9,24 +9,26 @@ import (
 	"github.com/kznrluk/aski/pkg/command"
 	"github.com/kznrluk/aski/pkg/config"
 	"github.com/kznrluk/aski/pkg/conv"
+	"github.com/kznrluk/aski/pkg/history"
+	"github.com/kznrluk/aski/pkg/redact"
 	"github.com/mattn/go-colorable"
 	"github.com/nyaosorg/go-readline-ny"
 	"github.com/nyaosorg/go-readline-ny/coloring"
+	"github.com/nyaosorg/go-readline-ny/keys"
 	"github.com/nyaosorg/go-readline-ny/simplehistory"
 	"io"
-	"os"
-	"path/filepath"
 	"strings"
-	"time"
 )
 
-func StartDialog(cfg config.Config, cv conv.Conversation, isRestMode bool) {
+// StartDialog reads messages and commands until the user exits. Errors of a single request are printed and the
+// dialog goes on. The returned error is from setting up the client or saving the conversation.
+func StartDialog(cfg config.Config, cv conv.Conversation, isRestMode bool) (err error) {
 
 	if isRestMode {
 		fmt.Printf("REST Mode \n")
 	}
 
-	history := simplehistory.New()
+	inputHistory := simplehistory.New()
 
 	profile := cv.GetProfile()
 	editor := &readline.Editor{
@@ -34,26 +36,30 @@ func StartDialog(cfg config.Config, cv conv.Conversation, isRestMode bool) {
 			return io.WriteString(w, "\u001B[0m"+profile.UserName+"@"+profile.ProfileName+"> ") // print `$ ` with cyan
 		},
 		Writer:         colorable.NewColorableStdout(),
-		History:        history,
+		History:        inputHistory,
 		Coloring:       &coloring.VimBatch{},
 		HistoryCycling: true,
 	}
 
+	if err := command.Register(cfg, profile); err != nil {
+		return err
+	}
+
 	editor.Init()
+	editor.BindKey(keys.CtrlI, completeCommand(func() conv.Conversation { return cv }))
 	fmt.Printf("Profile: %s, Model: %s \n", profile.ProfileName, profile.Model)
 
 	cli, err := chat.ProvideChat(profile.Vendor, profile.Model, cfg)
 	if err != nil {
-		fmt.Printf("error providing chat client: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error providing chat client: %w", err)
 	}
 
 	defer func() {
 		if profile.AutoSave {
-			fn, err := saveConversation(cv)
-			if err != nil {
-				fmt.Printf("\n error saving conversation: %v\n", err)
-				os.Exit(1)
+			fn, saveErr := history.Save(cv)
+			if saveErr != nil {
+				err = fmt.Errorf("error saving conversation: %w", saveErr)
+				return
 			}
 			fmt.Println(fn)
 		}
@@ -69,36 +75,54 @@ func StartDialog(cfg config.Config, cv conv.Conversation, isRestMode bool) {
 		if err != nil {
 			if errors.Is(err, readline.CtrlC) {
 				fmt.Println("\nSIGINT received, exiting...")
-				return
+				return nil
 			} else if errors.Is(err, io.EOF) {
-				return
+				return nil
 			}
 			fmt.Printf("Error Occured: %v\n", err)
 			continue
 		}
 
-		history.Add(input)
+		inputHistory.Add(input)
 
 		if input == "" {
 			continue
 		}
 
 		if input[0] == ':' {
-			newcv, cont, commandErr := command.Parse(input, cv)
+			newcv, cont, commandErr := command.Parse(input, cv, cfg)
 			if commandErr != nil {
 				if errors.Is(commandErr, command.ErrShouldExit) {
-					return
+					return nil
 				}
 				fmt.Printf("error: %v\n", commandErr)
 			}
 
+			// :profile and :model change the profile of the conversation.
+			if p := cv.GetProfile(); p.ProfileName != profile.ProfileName || p.Vendor != profile.Vendor || p.Model != profile.Model {
+				if next, err := chat.ProvideChat(p.Vendor, p.Model, cfg); err != nil {
+					fmt.Printf("error: %v\n", err)
+				} else {
+					cli = next
+				}
+				if err := command.Register(cfg, p); err != nil {
+					fmt.Printf("error: %v\n", err)
+				}
+			}
+			profile = cv.GetProfile()
+
 			if !cont {
 				continue
 			}
 
 			cv = newcv
-		} else {
-			cv.Append(conv.ChatRoleUser, input)
+		} else if _, err := cv.Append(conv.ChatRoleUser, input); err != nil {
+			fmt.Printf("error: %v\n", err)
+			continue
+		}
+
+		if profile.AutoCompact && chat.NeedsCompaction(cv) {
+			autoCompact(cli, cv)
 		}
 
 		last := cv.Last()
@@ -107,6 +131,14 @@ func StartDialog(cfg config.Config, cv conv.Conversation, isRestMode bool) {
 		fmt.Print(fmt.Sprintf("%s", last.Content))
 		fmt.Print(yellow(fmt.Sprintf(" [%.*s]\n", 6, last.Sha1)))
 
+		if len(last.Redactions) > 0 {
+			fmt.Print(yellow(fmt.Sprintf("Redacted secrets: %s\n", redact.Summary(last.Redactions))))
+		}
+
+		if _, excluded := cv.RequestMessages(); len(excluded) > 0 {
+			showExcluded(excluded)
+		}
+
 		messages := cv.MessagesFromHead()
 		if len(messages) > 0 {
 			lastMessage := messages[len(messages)-1]
@@ -117,22 +149,34 @@ func StartDialog(cfg config.Config, cv conv.Conversation, isRestMode bool) {
 		data, err := cli.Retrieve(cv, isRestMode)
 		if err != nil {
 			if errors.Is(err, chat.ErrCancelled) {
+				// Moving HEAD back restores the system prompt of the parent, keep one changed with :system.
+				system := cv.GetSystem()
 				_, _ = cv.ChangeHead(last.ParentSha1)
+				cv.SetSystem(system)
 				continue
 			}
 			fmt.Printf("\n%s", err.Error())
 			continue
 		}
 
-		msg := cv.Append(conv.ChatRoleAssistant, data)
+		msg, err := appendReply(cv, data)
+		if err != nil {
+			fmt.Printf("\nerror: %v\n", err)
+			continue
+		}
 		fmt.Print(yellow(fmt.Sprintf(" [%.*s]\n", 6, msg.Sha1)))
+
+		if profile.AutoTitle && cv.GetTitle() == "" {
+			autoTitle(cli, cv)
+		}
 	}
 }
 
+// OneShot retrieves a single response. The conversation is saved even when the request fails.
 func OneShot(cfg config.Config, cv conv.Conversation, isRestMode bool) (string, error) {
 	defer func() {
 		if cv.GetProfile().AutoSave {
-			fn, err := saveConversation(cv)
+			fn, err := history.Save(cv)
 			if err != nil {
 				fmt.Printf("\n error saving conversation: %v\n", err)
 			} else {
@@ -144,22 +188,46 @@ func OneShot(cfg config.Config, cv conv.Conversation, isRestMode bool) (string,
 	profile := cv.GetProfile()
 	cli, err := chat.ProvideChat(profile.Vendor, profile.Model, cfg)
 	if err != nil {
-		return "", fmt.Errorf("error providing chat client: %v", err)
+		return "", fmt.Errorf("error providing chat client: %w", err)
+	}
+
+	if profile.AutoCompact && chat.NeedsCompaction(cv) {
+		autoCompact(cli, cv)
 	}
 
 	data, err := cli.Retrieve(cv, isRestMode)
 
 	fmt.Printf("\n") // in some cases, shell prompt delete the last line so we add a new line
 	if err != nil {
-		fmt.Println(err.Error())
-		return "", nil
+		return "", err
 	}
 
-	cv.Append(conv.ChatRoleAssistant, data)
+	if _, err := appendReply(cv, data); err != nil {
+		return "", err
+	}
+
+	if profile.AutoTitle && cv.GetTitle() == "" {
+		if title, err := chat.GenerateTitle(cli, cv); err == nil {
+			cv.SetTitle(title)
+		}
+	}
 
 	return data, nil
 }
 
+// appendReply appends a retrieved reply with the model and the profile that produced it.
+func appendReply(cv conv.Conversation, data string) (conv.Message, error) {
+	msg, err := cv.Append(conv.ChatRoleAssistant, data)
+	if err != nil {
+		return conv.Message{}, err
+	}
+
+	profile := cv.GetProfile()
+	msg.Model = profile.Model
+	msg.Profile = profile.ProfileName
+	return msg, cv.Modify(msg)
+}
+
 func getInput(reader *readline.Editor) (string, error) {
 
 	ctx := context.Background()
@@ -171,40 +239,41 @@ func getInput(reader *readline.Editor) (string, error) {
 	return strings.TrimSpace(input), nil
 }
 
-func saveConversation(conv conv.Conversation) (string, error) {
-	t := time.Now()
-
-	if len(conv.GetMessages()) == 0 {
-		return "", nil
-	}
-
-	filename := conv.GetFilename()
-	if filename == "" {
-		filename = fmt.Sprintf("%s.yaml", t.Format("20060102-150405"))
-	}
+func autoCompact(cli chat.Chat, cv conv.Conversation) {
+	yellow := color.New(color.FgHiYellow).SprintFunc()
+	before := chat.RequestTokens(cv)
+	fmt.Print(yellow(fmt.Sprintf("\nRequest is ~%d tokens, over the budget of %d. Compacting older messages...\n", before, cv.GetProfile().GetRequestBudget())))
 
-	homeDir, err := config.GetHomeDir()
+	_, summarized, err := chat.Compact(cli, cv)
 	if err != nil {
-		return "", fmt.Errorf("error getting home directory: %v", err)
-	}
-
-	configDir := filepath.Join(homeDir, ".aski", "history")
-	if err := os.MkdirAll(configDir, 0700); err != nil {
-		return filename, err
+		fmt.Printf("error compacting conversation: %v\n", err)
+		return
 	}
+	fmt.Print(yellow(fmt.Sprintf("Compacted %d messages. ~%d -> ~%d tokens\n", summarized, before, chat.RequestTokens(cv))))
+}
 
-	yamlString, err := conv.ToYAML()
+func autoTitle(cli chat.Chat, cv conv.Conversation) {
+	title, err := chat.GenerateTitle(cli, cv)
 	if err != nil {
-		return filename, err
+		fmt.Printf("error generating title: %v\n", err)
+		return
 	}
 
-	filePath := filepath.Join(configDir, filename)
-	err = os.WriteFile(filePath, yamlString, 0600)
-	if err != nil {
-		return filename, err
-	}
+	cv.SetTitle(title)
+	yellow := color.New(color.FgHiYellow).SprintFunc()
+	fmt.Print(yellow(fmt.Sprintf("Title: %s\n", title)))
+}
 
-	return filename, nil
+func showExcluded(excluded []conv.Message) {
+	yellow := color.New(color.FgHiYellow).SprintFunc()
+	fmt.Print(yellow(fmt.Sprintf("\nExcluded from this request by the context strategy: %d messages\n", len(excluded))))
+	for _, msg := range excluded {
+		content := strings.ReplaceAll(msg.Content, "\n", " ")
+		if len([]rune(content)) > 40 {
+			content = string([]rune(content)[:40]) + "..."
+		}
+		fmt.Print(yellow(fmt.Sprintf("  [%.*s] %s: %s\n", 6, msg.Sha1, msg.Role, content)))
+	}
 }
 
 func showPendingHeader(role string, to conv.Message) {
@@ -0,0 +1,29 @@
+package lib
+
+import (
+	"github.com/kznrluk/aski/pkg/config"
+	"github.com/kznrluk/aski/pkg/conv"
+	"testing"
+)
+
+func TestAppendReply(t *testing.T) {
+	cv := conv.NewConversation(config.InitialProfile())
+	_, _ = cv.Append(conv.ChatRoleUser, "hello")
+
+	answer, err := appendReply(cv, "hi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer.Model != config.InitialProfile().Model || answer.Profile != config.InitialProfile().ProfileName {
+		t.Errorf("Expected the model and the profile on the reply, but got %+v", answer)
+	}
+
+	profile := cv.GetProfile()
+	profile.Model = "gpt-4o"
+	_ = cv.SetProfile(profile)
+	_, _ = cv.Append(conv.ChatRoleUser, "again")
+	_, _ = appendReply(cv, "hi")
+	if got := cv.Last().Model; got != "gpt-4o" {
+		t.Errorf("Expected the switched model to be saved, but got %s", got)
+	}
+}
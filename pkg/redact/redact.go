@@ -0,0 +1,109 @@
+package redact
+
+import (
+	"fmt"
+	"github.com/kznrluk/aski/pkg/config"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// detector - A kind of secret. When the pattern has a capturing group, only the group is replaced
+// so that the surrounding key name stays readable.
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+var builtinDetectors = []detector{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{"anthropic-api-key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{"openai-api-key", regexp.MustCompile(`\bsk-(?:proj-|svcacct-|admin-)?[A-Za-z0-9_-]{20,}`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"google-api-key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}`)},
+	// Assignments such as SECRET_KEY=... in .env files.
+	{"secret", regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+)?[A-Z0-9_.-]*(?:SECRET|PASSWORD|PASSWD|TOKEN|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIALS?)[A-Z0-9_.-]*[ \t]*[:=][ \t]*["']?([^\s"'#]{6,})`)},
+}
+
+// Redactor replaces secrets with placeholders such as [REDACTED:aws-access-key].
+type Redactor struct {
+	detectors []detector
+}
+
+// New returns a redactor with the built-in detectors followed by the patterns of the profile.
+// It returns nil when redaction is disabled.
+func New(r config.Redaction) (*Redactor, error) {
+	if r.Disabled {
+		return nil, nil
+	}
+
+	detectors := append([]detector{}, builtinDetectors...)
+	for _, p := range r.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %v", p.Name, err)
+		}
+		detectors = append(detectors, detector{name: p.Name, pattern: re})
+	}
+
+	return &Redactor{detectors: detectors}, nil
+}
+
+// Redact returns the text with secrets replaced and the number of secrets replaced by each detector.
+func (r *Redactor) Redact(text string) (string, map[string]int) {
+	if r == nil {
+		return text, nil
+	}
+
+	var found map[string]int
+	for _, d := range r.detectors {
+		placeholder := "[REDACTED:" + d.name + "]"
+
+		var b strings.Builder
+		last := 0
+		for _, loc := range d.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if strings.Contains(text[start:end], "[REDACTED:") {
+				continue
+			}
+
+			b.WriteString(text[last:start])
+			b.WriteString(placeholder)
+			last = end
+
+			if found == nil {
+				found = map[string]int{}
+			}
+			found[d.name]++
+		}
+
+		if last > 0 {
+			b.WriteString(text[last:])
+			text = b.String()
+		}
+	}
+
+	return text, found
+}
+
+// Summary formats the counts returned by Redact, such as "aws-access-key x1, jwt x2".
+func Summary(found map[string]int) string {
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s x%d", name, found[name]))
+	}
+	return strings.Join(parts, ", ")
+}
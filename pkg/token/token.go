@@ -0,0 +1,81 @@
+package token
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// perMessageOverhead approximates the tokens spent on role markers and separators for each message.
+const perMessageOverhead = 4
+
+// Estimate returns a rough token count for the given text.
+// ASCII text is counted as about 4 characters per token and other characters as one token each,
+// which is close enough for budgeting without shipping a tokenizer per vendor.
+func Estimate(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	ascii := 0
+	other := 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+
+	return (ascii+3)/4 + other
+}
+
+// EstimateMessage returns a rough token count for a single chat message including its overhead.
+func EstimateMessage(content string) int {
+	return Estimate(content) + perMessageOverhead
+}
+
+type window struct {
+	prefix string
+	tokens int
+}
+
+// windows is ordered so that more specific prefixes come first.
+var windows = []window{
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-1106", 128000},
+	{"gpt-4-0125", 128000},
+	{"gpt-4-vision", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo-instruct", 4096},
+	{"gpt-3.5-turbo", 16385},
+	{"claude-3", 200000},
+	{"claude-2.1", 200000},
+	{"claude-2", 100000},
+	{"claude-instant", 100000},
+}
+
+// DefaultContextWindow is used for models missing from the registry. It is as large as the windows of current
+// models, so that AutoCompact does not summarize conversations of newer models too early.
+const DefaultContextWindow = 128000
+
+// unknownModels holds the models the default window was assumed for, to warn about each of them once.
+var unknownModels sync.Map
+
+// ContextWindow returns the context window size in tokens for the given model name.
+func ContextWindow(model string) int {
+	m := strings.ToLower(model)
+	for _, w := range windows {
+		if strings.HasPrefix(m, w.prefix) {
+			return w.tokens
+		}
+	}
+	if _, warned := unknownModels.LoadOrStore(m, true); !warned {
+		slog.Warn(fmt.Sprintf("Context window of %s is unknown, assuming %d tokens. Set ContextWindow in the profile to change it.", model, DefaultContextWindow))
+	}
+	return DefaultContextWindow
+}
@@ -0,0 +1,67 @@
+package token
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{text: "", expected: 0},
+		{text: "abcd", expected: 1},
+		{text: "abcde", expected: 2},
+		{text: "日本語", expected: 3},
+		{text: "ab日本", expected: 3},
+	}
+
+	for _, tt := range tests {
+		if got := Estimate(tt.text); got != tt.expected {
+			t.Errorf("Estimate(%q) = %d, expected %d", tt.text, got, tt.expected)
+		}
+	}
+
+	if got := EstimateMessage(""); got != perMessageOverhead {
+		t.Errorf("Expected the overhead for an empty message, but got %d", got)
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		model    string
+		expected int
+	}{
+		{model: "gpt-4o-mini", expected: 128000},
+		{model: "GPT-4-32k-0613", expected: 32768},
+		{model: "gpt-4-0613", expected: 8192},
+		{model: "gpt-3.5-turbo-instruct", expected: 4096},
+		{model: "gpt-3.5-turbo-0125", expected: 16385},
+		{model: "claude-3-opus-20240229", expected: 200000},
+		{model: "claude-2.1", expected: 200000},
+		{model: "claude-2.0", expected: 100000},
+		{model: "unknown-model", expected: DefaultContextWindow},
+	}
+
+	for _, tt := range tests {
+		if got := ContextWindow(tt.model); got != tt.expected {
+			t.Errorf("ContextWindow(%q) = %d, expected %d", tt.model, got, tt.expected)
+		}
+	}
+}
+
+func TestContextWindowWarnsOnce(t *testing.T) {
+	var b bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&b, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	ContextWindow("future-model")
+	ContextWindow("future-model")
+	if got := strings.Count(b.String(), "future-model is unknown"); got != 1 {
+		t.Errorf("Expected one warning about the unknown model, but got %d: %s", got, b.String())
+	}
+}